@@ -0,0 +1,769 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/time/rate"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var usageText = `Usage: fourfourtwo <command> [arguments]
+
+Commands:
+  crawl season --league 8 --season 2015   crawl all matches of a league season
+  crawl day --date 2016-09-10             crawl all matches played on a day
+  crawl match --url <match url>           crawl a single match
+  crawl resume                            re-crawl matches whose crawl was interrupted
+  retry-failures [--max-attempts 3]       re-attempt the pages recorded in crawl_failure
+  migrate up                              apply pending schema migrations (done by every crawl)
+  migrate status                          list schema migrations and when they were applied
+  players list [--name Sanchez]           list known players, optionally those ever named like --name
+  players show --id 1234                  show a player's canonical name, name history and appearances
+  teams list                              list teams with their aliases and number of matches
+  teams duplicates                        list pairs of teams that are likely the same team
+  teams merge --from 12 --into 3          merge team 12 into team 3, keeping its name as an alias
+  events report [--unknown]               count events by raw marker or icon, with sample pages
+  events remap --event-types types.json   re-derive stored event types from their raw types
+  render player --id 44346 --season 2015  plot a player's events of a season, one pitch per category
+  render zones --id 44346 --season 2015   draw a player's (or --team's) events per zone or as a heatmap,
+        [--grid 6x4|18] [--stat count|success|density] [--category pass]
+  render passes --id 44346 --season 2015  draw a player's passes as arrows, with pass statistics,
+        [--match <match id>] [--half 1|2] [--minutes 60-90]
+  render shots --id 44346 --season 2015   plot a player's (or --team's) shots sized by their xG
+  shots fit                               fit the xG model on all shots and store every shot's xG
+  shots score                             store the xG of shots crawled since the last fit
+  shots report --season 2015              list xG against goals per player (or --by-team),
+        [--id 44346|--team 3] [--by-team] [--per-match]
+  stats player --id 44346 --season 2015   count a player's events per type and category, per 90 minutes,
+        [--per-match] [--format table|csv|json]
+  export events --format parquet          write events joined with their player, match, league and team,
+        [--league 8] [--season 2015] [--team 3] [--id 44346] [--format csv|ndjson|parquet] [--out events.parquet]
+
+Common crawl flags:
+  --db             path of the sqlite database, or a postgres:// url (default fourfourtwo.db)
+  --workers        number of player stats crawlers (default 10)
+  --match-workers  number of match page crawlers (default 3)
+  --limit          crawl at most this many matches, 0 means no limit
+  --cache          directory to keep a compressed copy of every fetched page in
+  --replay         serve pages from --cache only, never touching the network
+  --rate           requests per second to the site, shared by all crawlers (default 1)
+  --burst          requests allowed at once above --rate (default 1)
+  --retries        retries of a timed out, 429 or 5xx request (default 5)
+  --event-types    json file of raw marker or icon names to event types, added to the built-in ones
+  --force          crawl matches again even if they were crawled completely before
+`
+
+func usage() {
+	fmt.Fprint(os.Stderr, usageText)
+}
+
+// CrawlOptions are the flags shared by all crawl subcommands.
+type CrawlOptions struct {
+	DbPath       string
+	Workers      int
+	MatchWorkers int
+	Limit        int
+	CacheDir     string
+	Replay       bool
+	Rate         float64
+	Burst        int
+	Retries      int
+	EventTypes   string
+	Force        bool
+}
+
+func addCrawlFlags(fs *flag.FlagSet) *CrawlOptions {
+	opts := &CrawlOptions{}
+	fs.StringVar(&opts.DbPath, "db", "fourfourtwo.db", "path of the sqlite database, or a postgres:// url")
+	fs.IntVar(&opts.Workers, "workers", NUM_PLAYER_STATS_CRAWLER, "number of player stats crawlers")
+	fs.IntVar(&opts.MatchWorkers, "match-workers", NUM_MATCH_CRAWLER, "number of match page crawlers")
+	fs.IntVar(&opts.Limit, "limit", 0, "crawl at most this many matches, 0 means no limit")
+	fs.StringVar(&opts.CacheDir, "cache", "", "directory to keep a compressed copy of every fetched page in")
+	fs.BoolVar(&opts.Replay, "replay", false, "serve pages from --cache only, never touching the network")
+	fs.Float64Var(&opts.Rate, "rate", 1, "requests per second to the site, shared by all crawlers")
+	fs.IntVar(&opts.Burst, "burst", 1, "requests allowed at once above --rate")
+	fs.IntVar(&opts.Retries, "retries", 5, "retries of a timed out, 429 or 5xx request")
+	fs.StringVar(&opts.EventTypes, "event-types", "", "json file of raw marker or icon names to event types")
+	fs.BoolVar(&opts.Force, "force", false, "crawl matches again even if they were crawled completely before")
+	return opts
+}
+
+// loadEventTypes adds the event types of the --event-types file, if given, to EventTypeMap.
+func loadEventTypes(path string) {
+	if path == "" {
+		return
+	}
+	if err := LoadEventTypeMap(path); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFetcher builds the fetcher selected by the --cache and --replay flags.
+func (opts *CrawlOptions) NewFetcher() Fetcher {
+	if opts.Replay {
+		if opts.CacheDir == "" {
+			log.Fatal("--replay requires --cache")
+		}
+		return NewReplayFetcher(opts.CacheDir)
+	}
+
+	limiter := rate.NewLimiter(rate.Limit(opts.Rate), opts.Burst)
+	httpFetcher := NewHttpFetcher(limiter, opts.Retries)
+	if opts.CacheDir != "" {
+		return NewCachingFetcher(opts.CacheDir, httpFetcher)
+	}
+	return httpFetcher
+}
+
+func runCrawl(args []string) {
+	if len(args) < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("crawl "+args[0], flag.ExitOnError)
+	opts := addCrawlFlags(fs)
+	leagueId := fs.String("league", "", "league id, e.g. 8 for the Premier League (crawl season)")
+	season := fs.String("season", "", "first year of the season, e.g. 2015 (crawl season)")
+	date := fs.String("date", "", "match day in yyyy-mm-dd format (crawl day)")
+	url := fs.String("url", "", "url of the match page (crawl match)")
+	fs.Parse(args[1:])
+	loadEventTypes(opts.EventTypes)
+
+	ctx := interruptibleContext()
+	f := opts.NewFetcher()
+	store := openStore(opts.DbPath)
+	defer store.Close()
+
+	// a listing that fails, or some of whose rows do, is recorded as a failure and the matches found are crawled
+	matches := make([]Match, 0)
+	var err error
+
+	switch args[0] {
+	case "season":
+		if *leagueId == "" || *season == "" {
+			log.Fatal("crawl season: --league and --season are required")
+		}
+		if err = CrawlMatchesOfSeason(ctx, f, &matches, *season, *leagueId); err != nil {
+			store.RecordFailure(SeasonUrl(*season, *leagueId), StageSeason, "", err)
+		}
+	case "day":
+		if *date == "" {
+			log.Fatal("crawl day: --date is required")
+		}
+		if err = CrawlMatchesOfDay(ctx, f, &matches, *date); err != nil {
+			store.RecordFailure(DayUrl(*date), StageDay, "", err)
+		}
+	case "match":
+		if *url == "" {
+			log.Fatal("crawl match: --url is required")
+		}
+		// the match page has no teams, date or score, so take them from an earlier crawl of its day or season
+		m := NewMatchFromUrl(*url)
+		if stored, getErr := store.GetMatch(m.Id); getErr == nil {
+			m = *stored
+		} else if getErr != sql.ErrNoRows {
+			log.Fatal(getErr)
+		}
+		matches = append(matches, m)
+	case "resume":
+		if matches, err = store.ListUncrawled(); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("resuming %d interrupted matches\n", len(matches))
+	default:
+		fmt.Fprintf(os.Stderr, "unknown crawl target %q\n\n", args[0])
+		usage()
+		os.Exit(2)
+	}
+
+	if opts.Limit > 0 && opts.Limit < len(matches) {
+		matches = matches[:opts.Limit]
+	}
+	CrawlMatches(ctx, store, opts, f, matches)
+}
+
+func runRetryFailures(args []string) {
+	fs := flag.NewFlagSet("retry-failures", flag.ExitOnError)
+	opts := addCrawlFlags(fs)
+	maxAttempts := fs.Int64("max-attempts", 0, "skip pages that already failed this many times, 0 means no limit")
+	fs.Parse(args)
+	loadEventTypes(opts.EventTypes)
+
+	ctx := interruptibleContext()
+	f := opts.NewFetcher()
+	store := openStore(opts.DbPath)
+	defer store.Close()
+
+	failures, err := store.ListFailures(*maxAttempts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if opts.Limit > 0 && opts.Limit < len(failures) {
+		failures = failures[:opts.Limit]
+	}
+	fmt.Printf("retrying %d failed pages\n", len(failures))
+
+	matches := RetryFailures(ctx, store, f, failures)
+	CrawlMatches(ctx, store, opts, f, matches)
+}
+
+func connectStore(dsn string) Store {
+	store, err := OpenStore(dsn)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return store
+}
+
+// openStore connects to the database and brings its schema up to date.
+func openStore(dsn string) Store {
+	store := connectStore(dsn)
+	applied, err := store.Migrate()
+	for _, m := range applied {
+		fmt.Fprintf(os.Stderr, "applied migration %d: %s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return store
+}
+
+// openDB is openStore for the commands that run their own queries on the database.
+func openDB(dsn string) *sqlx.DB {
+	return openStore(dsn).DB()
+}
+
+// openQueryDB connects to an existing database for the commands that only read from it. Its schema is not migrated
+// behind the user's back, it has to be up to date already.
+func openQueryDB(dsn string) *sqlx.DB {
+	store, err := OpenExistingStore(dsn)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	status, err := store.MigrationsStatus()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	for _, m := range status {
+		if m.AppliedAt == "" {
+			log.Fatalf("migration %d (%s) is pending, run `fourfourtwo migrate up` first", m.Version, m.Name)
+		}
+	}
+	return store.DB()
+}
+
+func runMigrate(args []string) {
+	if len(args) < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("migrate "+args[0], flag.ExitOnError)
+	dbPath := fs.String("db", "fourfourtwo.db", "path of the sqlite database, or a postgres:// url")
+	fs.Parse(args[1:])
+
+	switch args[0] {
+	case "up":
+		store := openStore(*dbPath)
+		store.Close()
+	case "status":
+		store, err := OpenExistingStore(*dbPath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer store.Close()
+		status, err := store.MigrationsStatus()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, m := range status {
+			appliedAt := m.AppliedAt
+			if appliedAt == "" {
+				appliedAt = "pending"
+			}
+			fmt.Printf("%4d  %-24s  %s\n", m.Version, m.Name, appliedAt)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown migrate command %q\n\n", args[0])
+		usage()
+		os.Exit(2)
+	}
+}
+
+func runPlayers(args []string) {
+	if len(args) < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("players "+args[0], flag.ExitOnError)
+	dbPath := fs.String("db", "fourfourtwo.db", "path of the sqlite database, or a postgres:// url")
+	name := fs.String("name", "", "list only players ever named like this")
+	id := fs.String("id", "", "id of the player to show")
+	fs.Parse(args[1:])
+
+	db := openQueryDB(*dbPath)
+	defer db.Close()
+
+	switch args[0] {
+	case "list":
+		players, err := FindPlayers(db, *name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, p := range players {
+			fmt.Printf("%8s  %-32s  %s  %s\n", p.Id, p.Name, formatDate(p.FirstSeen), formatDate(p.LastSeen))
+		}
+	case "show":
+		if *id == "" {
+			log.Fatal("players show needs --id")
+		}
+		showPlayer(db, *id)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown players command %q\n\n", args[0])
+		usage()
+		os.Exit(2)
+	}
+}
+
+func showPlayer(db *sqlx.DB, id string) {
+	p, err := GetPlayer(db, id)
+	if err == sql.ErrNoRows {
+		log.Fatalf("no player with id %s", id)
+	} else if err != nil {
+		log.Fatal(err)
+	}
+	names, err := GetPlayerNames(db, id)
+	if err != nil {
+		log.Fatal(err)
+	}
+	appearances, err := GetPlayerAppearances(db, id)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("%s  %s  (%s to %s)\n", p.Id, p.Name, formatDate(p.FirstSeen), formatDate(p.LastSeen))
+	fmt.Println("\nNames:")
+	for _, n := range names {
+		fmt.Printf("  %-32s  %s  %s\n", n.Name, formatDate(n.FirstSeen), formatDate(n.LastSeen))
+	}
+	fmt.Printf("\nAppearances (%d):\n", len(appearances))
+	for _, a := range appearances {
+		sub := ""
+		if a.IsSubstitute {
+			sub = "sub"
+		}
+		minutes := "?"
+		if a.MinuteOn != nil && a.MinuteOff != nil {
+			minutes = fmt.Sprintf("%d-%d", *a.MinuteOn, *a.MinuteOff)
+			if a.SentOff {
+				minutes += " sent off"
+			}
+		}
+		fmt.Printf("  %s  %8s  %-24s  %s %d-%d %s  %-3s  %-5s  %d events\n", formatDate(a.MatchDate), a.MatchId, a.TeamName,
+			a.HomeTeamName, a.HomeScore, a.AwayScore, a.AwayTeamName, sub, minutes, a.Events)
+	}
+}
+
+func runTeams(args []string) {
+	if len(args) < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("teams "+args[0], flag.ExitOnError)
+	dbPath := fs.String("db", "fourfourtwo.db", "path of the sqlite database, or a postgres:// url")
+	from := fs.Int64("from", 0, "id of the team to merge away")
+	into := fs.Int64("into", 0, "id of the team to merge into")
+	fs.Parse(args[1:])
+
+	db := openDB(*dbPath)
+	defer db.Close()
+
+	switch args[0] {
+	case "list":
+		teams, err := ListTeams(db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, t := range teams {
+			fmt.Printf("%4d  %-32s  %4d matches  %s\n", t.Id, t.Name, t.Matches, strings.Join(t.Aliases, ", "))
+		}
+	case "duplicates":
+		pairs, err := SuspectedDuplicateTeams(db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, pair := range pairs {
+			fmt.Printf("%4d  %-32s  %4d  %s\n", pair[0].Id, pair[0].Name, pair[1].Id, pair[1].Name)
+		}
+	case "merge":
+		if *from == 0 || *into == 0 {
+			log.Fatal("teams merge needs --from and --into")
+		}
+		if err := MergeTeams(db, *from, *into); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("merged team %d into %d\n", *from, *into)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown teams command %q\n\n", args[0])
+		usage()
+		os.Exit(2)
+	}
+}
+
+func runEvents(args []string) {
+	if len(args) < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("events "+args[0], flag.ExitOnError)
+	dbPath := fs.String("db", "fourfourtwo.db", "path of the sqlite database, or a postgres:// url")
+	eventTypes := fs.String("event-types", "", "json file of raw marker or icon names to event types")
+	unknown := fs.Bool("unknown", false, "list only raw types that are not mapped to an event type")
+	samples := fs.Int("samples", 3, "number of sample pages to list per raw type")
+	fs.Parse(args[1:])
+	loadEventTypes(*eventTypes)
+
+	db := openDB(*dbPath)
+	defer db.Close()
+
+	switch args[0] {
+	case "report":
+		counts, err := ReportEventTypes(db, *samples, *unknown)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, c := range counts {
+			fmt.Printf("%-28s  %-24s  %8d\n", c.RawType, c.EventType, c.Count)
+			for _, url := range c.SampleUrls {
+				fmt.Printf("    %s\n", url)
+			}
+		}
+	case "remap":
+		changed, err := RemapEventTypes(db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("changed the type of %d events\n", changed)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown events command %q\n\n", args[0])
+		usage()
+		os.Exit(2)
+	}
+}
+
+func runRender(args []string) {
+	if len(args) < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("render "+args[0], flag.ExitOnError)
+	dbPath := fs.String("db", "fourfourtwo.db", "path of the sqlite database, or a postgres:// url")
+	id := fs.String("id", "", "id of the player")
+	teamId := fs.Int64("team", 0, "id of the team (render zones and shots)")
+	season := fs.Int("season", 0, "first year of the season, e.g. 2015")
+	out := fs.String("out", "output-images", "directory to write the images to")
+	format := fs.String("format", "png", "image format, png or svg")
+	grid := fs.String("grid", "6x4", "zones as <columns>x<rows>, or 18 for the Juego de Posición zones (render zones)")
+	stat := fs.String("stat", ZoneCount, "count, success or density (render zones)")
+	category := fs.String("category", "", "only events of this category, e.g. pass or shot (render zones)")
+	bandwidth := fs.Float64("bandwidth", 5, "kernel bandwidth in metres of --stat density (render zones)")
+	matchId := fs.String("match", "", "only passes of this match (render passes)")
+	half := fs.Int("half", 0, "only passes of this half, 1 or 2 (render passes)")
+	minutes := fs.String("minutes", "", "only passes in this range of minutes, e.g. 60-90 (render passes)")
+	fs.Parse(args[1:])
+
+	db := openQueryDB(*dbPath)
+	defer db.Close()
+
+	switch args[0] {
+	case "player":
+		if *id == "" || *season == 0 {
+			log.Fatal("render player: --id and --season are required")
+		}
+		path, err := RenderPlayerSeason(db, *id, *season, *out, *format)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(path)
+	case "zones":
+		if (*id == "") == (*teamId == 0) || *season == 0 {
+			log.Fatal("render zones: --season and either --id or --team are required")
+		}
+		g, err := ParseGrid(*grid)
+		if err != nil {
+			log.Fatal(err)
+		}
+		subject := *id
+		if subject == "" {
+			subject = fmt.Sprintf("team-%d", *teamId)
+		}
+		name := fmt.Sprintf("zones-%s-%d-%s-%s.%s", subject, *season, *stat, *category, *format)
+		if *category == "" {
+			name = fmt.Sprintf("zones-%s-%d-%s.%s", subject, *season, *stat, *format)
+		}
+		path := filepath.Join(*out, name)
+		filter := EventFilter{PlayerId: *id, TeamId: *teamId, Season: *season, Category: EventCategory(*category)}
+		if err := RenderZones(db, filter, g, *stat, *bandwidth, path, *format); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(path)
+	case "passes":
+		if *id == "" || *season == 0 {
+			log.Fatal("render passes: --id and --season are required")
+		}
+		from, to, err := ParseMinutes(*minutes)
+		if err != nil {
+			log.Fatal(err)
+		}
+		filter := PassFilter{PlayerId: *id, Season: *season, MatchId: *matchId, Half: *half, MinMinute: from, MaxMinute: to}
+		name := fmt.Sprintf("passes-%s-%d", *id, *season)
+		if *matchId != "" {
+			name += "-" + *matchId
+		}
+		if *half != 0 {
+			name += fmt.Sprintf("-h%d", *half)
+		}
+		if *minutes != "" {
+			name += "-" + *minutes
+		}
+		path := filepath.Join(*out, name+"."+*format)
+		stats, err := RenderPassMap(db, filter, path, *format)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, line := range stats.Lines() {
+			fmt.Println(line)
+		}
+		fmt.Println(path)
+	case "shots":
+		if (*id == "") == (*teamId == 0) || *season == 0 {
+			log.Fatal("render shots: --season and either --id or --team are required")
+		}
+		subject := *id
+		if subject == "" {
+			subject = fmt.Sprintf("team-%d", *teamId)
+		}
+		path := filepath.Join(*out, fmt.Sprintf("shots-%s-%d.%s", subject, *season, *format))
+		filter := EventFilter{PlayerId: *id, TeamId: *teamId, Season: *season}
+		if err := RenderShotMap(db, filter, path, *format); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(path)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown render command %q\n\n", args[0])
+		usage()
+		os.Exit(2)
+	}
+}
+
+func runShots(args []string) {
+	if len(args) < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("shots "+args[0], flag.ExitOnError)
+	dbPath := fs.String("db", "fourfourtwo.db", "path of the sqlite database, or a postgres:// url")
+	id := fs.String("id", "", "only shots of this player")
+	teamId := fs.Int64("team", 0, "only shots of this team")
+	season := fs.Int("season", 0, "first year of the season, e.g. 2015")
+	byTeam := fs.Bool("by-team", false, "sum per team instead of per player")
+	perMatch := fs.Bool("per-match", false, "sum per match instead of over the season")
+	fs.Parse(args[1:])
+
+	db := openDB(*dbPath)
+	defer db.Close()
+
+	switch args[0] {
+	case "fit":
+		m, err := FitXGModel(db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("fitted on %d shots, %d goals: logit(xG) = %.4f %+.4f * distance %+.4f * angle\n",
+			m.Shots, m.Goals, m.Intercept, m.DistanceCoef, m.AngleCoef)
+	case "score":
+		n, err := ScoreNewShots(db)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("scored %d shots\n", n)
+	case "report":
+		if *season == 0 {
+			log.Fatal("shots report: --season is required")
+		}
+		filter := EventFilter{PlayerId: *id, TeamId: *teamId, Season: *season}
+		totals, err := GetXGTotals(db, filter, *byTeam, *perMatch)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, t := range totals {
+			match := ""
+			if *perMatch {
+				match = fmt.Sprintf("%s  %-8s  ", formatDate(t.MatchDate), t.MatchId)
+			}
+			fmt.Printf("%s%-8s  %-32s  %4d shots  %3d goals  %6.2f xG  %+6.2f\n",
+				match, t.Id, t.Name, t.Shots, t.Goals, t.XG, float64(t.Goals)-t.XG)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown shots command %q\n\n", args[0])
+		usage()
+		os.Exit(2)
+	}
+}
+
+func runStats(args []string) {
+	if len(args) < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("stats "+args[0], flag.ExitOnError)
+	dbPath := fs.String("db", "fourfourtwo.db", "path of the sqlite database, or a postgres:// url")
+	id := fs.String("id", "", "id of the player")
+	season := fs.Int("season", 0, "first year of the season, e.g. 2015")
+	perMatch := fs.Bool("per-match", false, "break the counts down per match")
+	format := fs.String("format", "table", "output format, table, csv or json")
+	fs.Parse(args[1:])
+
+	db := openQueryDB(*dbPath)
+	defer db.Close()
+
+	switch args[0] {
+	case "player":
+		if *id == "" || *season == 0 {
+			log.Fatal("stats player: --id and --season are required")
+		}
+		stats, err := GetPlayerSeasonStats(db, *id, *season)
+		if err != nil {
+			log.Fatal(err)
+		}
+		switch *format {
+		case "table":
+			err = stats.WriteTable(os.Stdout, *perMatch)
+		case "csv":
+			err = stats.WriteCSV(os.Stdout, *perMatch)
+		case "json":
+			err = stats.WriteJSON(os.Stdout, *perMatch)
+		default:
+			err = fmt.Errorf("unknown output format %q", *format)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown stats command %q\n\n", args[0])
+		usage()
+		os.Exit(2)
+	}
+}
+
+func runExport(args []string) {
+	if len(args) < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("export "+args[0], flag.ExitOnError)
+	dbPath := fs.String("db", "fourfourtwo.db", "path of the sqlite database, or a postgres:// url")
+	leagueId := fs.String("league", "", "only events of this league")
+	season := fs.Int("season", 0, "only events of the season starting in this year, e.g. 2015")
+	teamId := fs.Int64("team", 0, "only events of this team")
+	id := fs.String("id", "", "only events of this player")
+	format := fs.String("format", "csv", "output format, csv, ndjson or parquet")
+	out := fs.String("out", "-", "file to write to, - for standard output")
+	fs.Parse(args[1:])
+	// checked before anything is opened, so a typo does not leave an empty file behind
+	if !ExportFormats[*format] {
+		log.Fatalf("export: unknown format %q, expected csv, ndjson or parquet", *format)
+	}
+
+	db := openQueryDB(*dbPath)
+	defer db.Close()
+
+	switch args[0] {
+	case "events":
+		f := os.Stdout
+		if *out != "-" {
+			var err error
+			if f, err = os.Create(*out); err != nil {
+				log.Fatal(err)
+			}
+		}
+		w, err := NewExportWriter(f, *format)
+		if err != nil {
+			log.Fatal(err)
+		}
+		n, err := ExportEvents(db, ExportFilter{*leagueId, *season, *teamId, *id}, w)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			log.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(os.Stderr, "exported %d events\n", n)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown export command %q\n\n", args[0])
+		usage()
+		os.Exit(2)
+	}
+}
+
+// formatDate prints a date as yyyy-mm-dd, or "unknown" if it is nil.
+func formatDate(t *time.Time) string {
+	if t == nil {
+		return "unknown   "
+	}
+	return t.Format("2006-01-02")
+}
+
+// CrawlMatches crawls the player stats and events of the given matches and returns when all of them are saved.
+func CrawlMatches(ctx context.Context, store Store, opts *CrawlOptions, f Fetcher, matches []Match) {
+	p := NewPipeline(ctx, store, f, PipelineOptions{
+		DiscoverWorkers: 1,
+		LineupWorkers:   opts.MatchWorkers,
+		EventWorkers:    opts.Workers,
+		PersistWorkers:  1,
+		Force:           opts.Force})
+	p.Start(matches)
+
+	if err := p.Wait(); err != nil {
+		fmt.Printf("crawl stopped (%v), run `crawl resume` to finish the interrupted matches\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("finished crawling %d matches", p.Crawled())
+	if skipped := p.Skipped(); skipped > 0 {
+		fmt.Printf(", skipped %d crawled before (--force crawls them again)", skipped)
+	}
+	fmt.Println()
+}
+
+// interruptibleContext returns a context that is cancelled on Ctrl-C or SIGTERM.
+func interruptibleContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		fmt.Println("interrupted, waiting for the workers to stop")
+		cancel()
+	}()
+	return ctx
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// UnknownEventType is the event type of events whose raw marker or icon is not in EventTypeMap. Their raw type is
+// kept, so they can be mapped later with RemapEventTypes.
+const UnknownEventType = "unknown"
+
+// eventTypeEntry is an event type in an --event-types file that also places the type in the EventTaxonomy.
+type eventTypeEntry struct {
+	EventClass
+	Type string `json:"type"`
+}
+
+// LoadEventTypeMap reads a json object of raw marker or icon names to event types from path and adds it to
+// EventTypeMap, overriding the built-in types of the same raw names. It has to be called before crawling starts.
+// An event type is either a plain string or an object that also classifies it:
+//
+//	{"smallpurple": {"type": "pass_through_ball", "category": "pass", "outcome": "success", "qualifiers": ["through_ball"]}}
+func LoadEventTypeMap(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	types := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &types); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	for raw, value := range types {
+		var eventType string
+		if err := json.Unmarshal(value, &eventType); err == nil {
+			EventTypeMap[raw] = eventType
+			continue
+		}
+		entry := eventTypeEntry{}
+		if err := json.Unmarshal(value, &entry); err != nil || entry.Type == "" {
+			return fmt.Errorf("%s: %q is neither an event type nor an object with a type", path, raw)
+		}
+		EventTypeMap[raw] = entry.Type
+		EventTaxonomy[entry.Type] = entry.EventClass
+	}
+	return nil
+}
+
+// MapEventType returns the event type of a raw marker or icon name.
+func MapEventType(rawType string) string {
+	if eventType, ok := EventTypeMap[rawType]; ok {
+		return eventType
+	}
+	return UnknownEventType
+}
+
+// rawTypeFromIcon falls back to the file name of an icon whose url does not look like the usual statzone icons.
+func rawTypeFromIcon(picUrl string) string {
+	name := path.Base(picUrl)
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// RawEventTypeCount is the number of events seen with one raw type, with the pages of a few of them.
+type RawEventTypeCount struct {
+	RawType    string `db:"raw_type"`
+	EventType  string `db:"event_type"`
+	Count      int64  `db:"count"`
+	SampleUrls []string
+}
+
+// ReportEventTypes counts the events of every raw type seen, with up to samples player stats pages each. With
+// unknownOnly it lists only the raw types that did not map to an event type.
+func ReportEventTypes(db *sqlx.DB, samples int, unknownOnly bool) ([]RawEventTypeCount, error) {
+	counts := []RawEventTypeCount{}
+	q := `SELECT coalesce(raw_type, '') AS raw_type, event_type, count(*) AS count FROM player_event
+			WHERE $1 = false OR event_type = $2
+			GROUP BY raw_type, event_type
+			ORDER BY count(*) DESC`
+	if err := db.Select(&counts, q, unknownOnly, UnknownEventType); err != nil {
+		return nil, err
+	}
+
+	sq := `SELECT DISTINCT ps.url FROM player_event e JOIN player_stats ps ON ps.id = e.player_stats_id
+			WHERE coalesce(e.raw_type, '') = $1 AND e.event_type = $2
+			ORDER BY ps.url LIMIT $3`
+	for i, _ := range counts {
+		if err := db.Select(&counts[i].SampleUrls, sq, counts[i].RawType, counts[i].EventType, samples); err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+// RemapEventTypes sets the event type and its class of every stored event from its raw type, the current
+// EventTypeMap and EventTaxonomy, e.g. after a type that was unknown at crawl time was added to the map.
+// It returns the number of events changed.
+func RemapEventTypes(db *sqlx.DB) (int64, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rawTypes := []string{}
+	if err := tx.Select(&rawTypes, `SELECT DISTINCT raw_type FROM player_event WHERE raw_type IS NOT NULL`); err != nil {
+		return 0, err
+	}
+
+	var changed int64
+	for _, rawType := range rawTypes {
+		e := PlayerEvent{EventType: MapEventType(rawType)}
+		e.Classify()
+		q := `UPDATE player_event SET event_type = $1, category = $2, outcome = $3, qualifiers = $4
+				WHERE raw_type = $5 AND NOT (event_type = $1 AND coalesce(category, '') = $2 AND coalesce(outcome, '') = $3 AND coalesce(qualifiers, '') = $4)`
+		res, err := tx.Exec(q, e.EventType, string(e.Category), string(e.Outcome), JoinQualifiers(e.Qualifiers), rawType)
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		changed += n
+	}
+	return changed, tx.Commit()
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/xitongsys/parquet-go-source/writerfile"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+	"io"
+	"strconv"
+	"time"
+)
+
+// ExportFilter selects the events to export, an empty or zero field selects all of them.
+type ExportFilter struct {
+	LeagueId string
+	Season   int
+	TeamId   int64
+	PlayerId string
+}
+
+// ExportRow is one event together with its player, match, league and team, so that it can be analysed without
+// joining the tables again.
+type ExportRow struct {
+	EventId       int64      `db:"event_id" json:"event_id"`
+	MatchId       string     `db:"match_id" json:"match_id"`
+	MatchDate     *time.Time `db:"match_date" json:"-"`
+	Date          string     `db:"-" json:"match_date"`
+	Season        int        `db:"season" json:"season"`
+	LeagueId      string     `db:"league_id" json:"league_id"`
+	LeagueName    string     `db:"league_name" json:"league_name"`
+	HomeTeamId    *int64     `db:"home_team_id" json:"home_team_id"`
+	HomeTeamName  string     `db:"home_team_name" json:"home_team_name"`
+	AwayTeamId    *int64     `db:"away_team_id" json:"away_team_id"`
+	AwayTeamName  string     `db:"away_team_name" json:"away_team_name"`
+	HomeScore     int        `db:"home_score" json:"home_score"`
+	AwayScore     int        `db:"away_score" json:"away_score"`
+	TeamId        *int64     `db:"team_id" json:"team_id"`
+	TeamName      string     `db:"team_name" json:"team_name"`
+	PlayerId      string     `db:"player_id" json:"player_id"`
+	PlayerName    string     `db:"player_name" json:"player_name"`
+	IsSubstitute  bool       `db:"is_substitute" json:"is_substitute"`
+	MinutesPlayed *int       `db:"minutes_played" json:"minutes_played"`
+	EventHalf     int        `db:"event_half" json:"event_half"`
+	EventMinute   int        `db:"event_minute" json:"event_minute"`
+	EventType     string     `db:"event_type" json:"event_type"`
+	RawType       string     `db:"raw_type" json:"raw_type"`
+	Category      string     `db:"category" json:"category"`
+	Outcome       string     `db:"outcome" json:"outcome"`
+	Qualifiers    string     `db:"qualifiers" json:"qualifiers"`
+	X1            *float64   `db:"x1" json:"x1"`
+	Y1            *float64   `db:"y1" json:"y1"`
+	X2            *float64   `db:"x2" json:"x2"`
+	Y2            *float64   `db:"y2" json:"y2"`
+	PitchX1       *float64   `db:"pitch_x1" json:"pitch_x1"`
+	PitchY1       *float64   `db:"pitch_y1" json:"pitch_y1"`
+	PitchX2       *float64   `db:"pitch_x2" json:"pitch_x2"`
+	PitchY2       *float64   `db:"pitch_y2" json:"pitch_y2"`
+	XG            *float64   `db:"xg" json:"xg"`
+}
+
+// exportColumns are the columns of an export, in the order of ExportRow.
+var exportColumns = []string{"event_id", "match_id", "match_date", "season", "league_id", "league_name",
+	"home_team_id", "home_team_name", "away_team_id", "away_team_name", "home_score", "away_score",
+	"team_id", "team_name", "player_id", "player_name", "is_substitute", "minutes_played",
+	"event_half", "event_minute", "event_type", "raw_type", "category", "outcome", "qualifiers",
+	"x1", "y1", "x2", "y2", "pitch_x1", "pitch_y1", "pitch_x2", "pitch_y2", "xg"}
+
+// record returns the values of r as text, in the order of exportColumns. NULL values are empty.
+func (r *ExportRow) record() []string {
+	optInt := func(v *int64) string {
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatInt(*v, 10)
+	}
+	optFloat := func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	}
+	minutes := ""
+	if r.MinutesPlayed != nil {
+		minutes = strconv.Itoa(*r.MinutesPlayed)
+	}
+	return []string{strconv.FormatInt(r.EventId, 10), r.MatchId, r.Date, strconv.Itoa(r.Season), r.LeagueId, r.LeagueName,
+		optInt(r.HomeTeamId), r.HomeTeamName, optInt(r.AwayTeamId), r.AwayTeamName, strconv.Itoa(r.HomeScore), strconv.Itoa(r.AwayScore),
+		optInt(r.TeamId), r.TeamName, r.PlayerId, r.PlayerName, strconv.FormatBool(r.IsSubstitute), minutes,
+		strconv.Itoa(r.EventHalf), strconv.Itoa(r.EventMinute), r.EventType, r.RawType, r.Category, r.Outcome, r.Qualifiers,
+		optFloat(r.X1), optFloat(r.Y1), optFloat(r.X2), optFloat(r.Y2),
+		optFloat(r.PitchX1), optFloat(r.PitchY1), optFloat(r.PitchX2), optFloat(r.PitchY2), optFloat(r.XG)}
+}
+
+// parquetExportRow is the schema of a parquet export, with the same columns as the other formats.
+type parquetExportRow struct {
+	EventId       int64    `parquet:"name=event_id, type=INT64"`
+	MatchId       string   `parquet:"name=match_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	MatchDate     string   `parquet:"name=match_date, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Season        int32    `parquet:"name=season, type=INT32"`
+	LeagueId      string   `parquet:"name=league_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	LeagueName    string   `parquet:"name=league_name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	HomeTeamId    *int64   `parquet:"name=home_team_id, type=INT64, repetitiontype=OPTIONAL"`
+	HomeTeamName  string   `parquet:"name=home_team_name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	AwayTeamId    *int64   `parquet:"name=away_team_id, type=INT64, repetitiontype=OPTIONAL"`
+	AwayTeamName  string   `parquet:"name=away_team_name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	HomeScore     int32    `parquet:"name=home_score, type=INT32"`
+	AwayScore     int32    `parquet:"name=away_score, type=INT32"`
+	TeamId        *int64   `parquet:"name=team_id, type=INT64, repetitiontype=OPTIONAL"`
+	TeamName      string   `parquet:"name=team_name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	PlayerId      string   `parquet:"name=player_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	PlayerName    string   `parquet:"name=player_name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	IsSubstitute  bool     `parquet:"name=is_substitute, type=BOOLEAN"`
+	MinutesPlayed *int32   `parquet:"name=minutes_played, type=INT32, repetitiontype=OPTIONAL"`
+	EventHalf     int32    `parquet:"name=event_half, type=INT32"`
+	EventMinute   int32    `parquet:"name=event_minute, type=INT32"`
+	EventType     string   `parquet:"name=event_type, type=BYTE_ARRAY, convertedtype=UTF8"`
+	RawType       string   `parquet:"name=raw_type, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Category      string   `parquet:"name=category, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Outcome       string   `parquet:"name=outcome, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Qualifiers    string   `parquet:"name=qualifiers, type=BYTE_ARRAY, convertedtype=UTF8"`
+	X1            *float64 `parquet:"name=x1, type=DOUBLE, repetitiontype=OPTIONAL"`
+	Y1            *float64 `parquet:"name=y1, type=DOUBLE, repetitiontype=OPTIONAL"`
+	X2            *float64 `parquet:"name=x2, type=DOUBLE, repetitiontype=OPTIONAL"`
+	Y2            *float64 `parquet:"name=y2, type=DOUBLE, repetitiontype=OPTIONAL"`
+	PitchX1       *float64 `parquet:"name=pitch_x1, type=DOUBLE, repetitiontype=OPTIONAL"`
+	PitchY1       *float64 `parquet:"name=pitch_y1, type=DOUBLE, repetitiontype=OPTIONAL"`
+	PitchX2       *float64 `parquet:"name=pitch_x2, type=DOUBLE, repetitiontype=OPTIONAL"`
+	PitchY2       *float64 `parquet:"name=pitch_y2, type=DOUBLE, repetitiontype=OPTIONAL"`
+	XG            *float64 `parquet:"name=xg, type=DOUBLE, repetitiontype=OPTIONAL"`
+}
+
+func newParquetExportRow(r *ExportRow) *parquetExportRow {
+	var minutes *int32
+	if r.MinutesPlayed != nil {
+		m := int32(*r.MinutesPlayed)
+		minutes = &m
+	}
+	return &parquetExportRow{
+		EventId:       r.EventId,
+		MatchId:       r.MatchId,
+		MatchDate:     r.Date,
+		Season:        int32(r.Season),
+		LeagueId:      r.LeagueId,
+		LeagueName:    r.LeagueName,
+		HomeTeamId:    r.HomeTeamId,
+		HomeTeamName:  r.HomeTeamName,
+		AwayTeamId:    r.AwayTeamId,
+		AwayTeamName:  r.AwayTeamName,
+		HomeScore:     int32(r.HomeScore),
+		AwayScore:     int32(r.AwayScore),
+		TeamId:        r.TeamId,
+		TeamName:      r.TeamName,
+		PlayerId:      r.PlayerId,
+		PlayerName:    r.PlayerName,
+		IsSubstitute:  r.IsSubstitute,
+		MinutesPlayed: minutes,
+		EventHalf:     int32(r.EventHalf),
+		EventMinute:   int32(r.EventMinute),
+		EventType:     r.EventType,
+		RawType:       r.RawType,
+		Category:      r.Category,
+		Outcome:       r.Outcome,
+		Qualifiers:    r.Qualifiers,
+		X1:            r.X1,
+		Y1:            r.Y1,
+		X2:            r.X2,
+		Y2:            r.Y2,
+		PitchX1:       r.PitchX1,
+		PitchY1:       r.PitchY1,
+		PitchX2:       r.PitchX2,
+		PitchY2:       r.PitchY2,
+		XG:            r.XG}
+}
+
+// ExportWriter writes export rows in one format. Close flushes what is buffered, but does not close the
+// underlying writer.
+type ExportWriter interface {
+	Write(r *ExportRow) error
+	Close() error
+}
+
+// parquetRowGroupSize bounds the rows a parquet export keeps in memory before writing them out, in bytes.
+const parquetRowGroupSize = 16 * 1024 * 1024
+
+// ExportFormats are the formats NewExportWriter writes, "jsonl" being another name for ndjson.
+var ExportFormats = map[string]bool{"csv": true, "ndjson": true, "jsonl": true, "parquet": true}
+
+// NewExportWriter returns a writer of the format csv, ndjson or parquet.
+func NewExportWriter(w io.Writer, format string) (ExportWriter, error) {
+	switch format {
+	case "csv":
+		out := csv.NewWriter(w)
+		if err := out.Write(exportColumns); err != nil {
+			return nil, err
+		}
+		return &csvExportWriter{out}, nil
+	case "ndjson", "jsonl":
+		buf := bufio.NewWriter(w)
+		return &jsonExportWriter{buf, json.NewEncoder(buf)}, nil
+	case "parquet":
+		pw, err := writer.NewParquetWriter(writerfile.NewWriterFile(w), new(parquetExportRow), 1)
+		if err != nil {
+			return nil, err
+		}
+		pw.RowGroupSize = parquetRowGroupSize
+		pw.CompressionType = parquet.CompressionCodec_SNAPPY
+		return &parquetExportWriter{pw}, nil
+	}
+	return nil, fmt.Errorf("unknown export format %q, expected csv, ndjson or parquet", format)
+}
+
+type csvExportWriter struct {
+	out *csv.Writer
+}
+
+func (w *csvExportWriter) Write(r *ExportRow) error {
+	return w.out.Write(r.record())
+}
+
+func (w *csvExportWriter) Close() error {
+	w.out.Flush()
+	return w.out.Error()
+}
+
+type jsonExportWriter struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func (w *jsonExportWriter) Write(r *ExportRow) error {
+	return w.enc.Encode(r)
+}
+
+func (w *jsonExportWriter) Close() error {
+	return w.buf.Flush()
+}
+
+type parquetExportWriter struct {
+	pw *writer.ParquetWriter
+}
+
+func (w *parquetExportWriter) Write(r *ExportRow) error {
+	return w.pw.Write(newParquetExportRow(r))
+}
+
+func (w *parquetExportWriter) Close() error {
+	return w.pw.WriteStop()
+}
+
+// ExportEvents writes the events selected by filter to w one row at a time, in the order the matches were played,
+// so that exports of any size run in constant memory. It returns the number of rows written.
+func ExportEvents(db *sqlx.DB, filter ExportFilter, w ExportWriter) (int, error) {
+	q := `SELECT e.id AS event_id, m.id AS match_id, m.match_date, m.season, m.league_id, coalesce(l.name, '') AS league_name,
+				m.home_team_id, m.home_team_name, m.away_team_id, m.away_team_name, coalesce(m.home_score, 0) AS home_score,
+				coalesce(m.away_score, 0) AS away_score,
+				ps.team_id, coalesce(t.name, ps.team_name) AS team_name, ps.player_id,
+				coalesce(p.name, ps.player_name) AS player_name, ps.is_substitute, ps.minutes_played,
+				coalesce(e.event_half, 0) AS event_half, coalesce(e.event_minute, 0) AS event_minute, e.event_type,
+				coalesce(e.raw_type, '') AS raw_type, coalesce(e.category, '') AS category,
+				coalesce(e.outcome, '') AS outcome, coalesce(e.qualifiers, '') AS qualifiers,
+				e.x1, e.y1, e.x2, e.y2, e.pitch_x1, e.pitch_y1, e.pitch_x2, e.pitch_y2, e.xg
+			FROM player_event e
+				JOIN player_stats ps ON ps.id = e.player_stats_id
+				JOIN match m ON m.id = ps.match_id
+				LEFT JOIN league l ON l.id = m.league_id
+				LEFT JOIN team t ON t.id = ps.team_id
+				LEFT JOIN player p ON p.id = ps.player_id
+			WHERE ($1 = '' OR m.league_id = $1) AND ($2 = 0 OR m.season = $2) AND ($3 = 0 OR ps.team_id = $3)
+				AND ($4 = '' OR ps.player_id = $4)
+			ORDER BY m.match_date, m.id, ps.id, e.id`
+	rows, err := db.Queryx(q, filter.LeagueId, filter.Season, filter.TeamId, filter.PlayerId)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		r := ExportRow{}
+		if err := rows.StructScan(&r); err != nil {
+			return n, err
+		}
+		if r.MatchDate != nil {
+			r.Date = r.MatchDate.Format("2006-01-02")
+		}
+		if err := w.Write(&r); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
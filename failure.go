@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+)
+
+// Stages of the crawl a failure can be recorded for.
+const (
+	StageSeason      = "season"
+	StageDay         = "day"
+	StageMatch       = "match"
+	StagePlayerStats = "player_stats"
+)
+
+// CrawlFailure is a page that could not be crawled, kept so it can be retried later.
+type CrawlFailure struct {
+	Id          int64  `db:"id"`
+	Url         string `db:"url"`
+	Stage       string `db:"stage"`
+	MatchId     string `db:"match_id"`
+	Error       string `db:"error"`
+	Attempts    int64  `db:"attempts"`
+	LastAttempt string `db:"last_attempt"`
+}
+
+// RecordFailure adds a failed page to the crawl_failure table, or bumps its attempt count if it failed before.
+func RecordFailure(s *Statements, url, stage, matchId string, cause error) {
+	fmt.Printf("[%s] %s failed: %v\n", stage, url, cause)
+
+	now := time.Now().UTC().Format("2006-01-02 15:04:05")
+	if _, err := s.Exec("crawl_failure.record", url, stage, matchId, cause.Error(), now); err != nil {
+		log.Printf("could not record failure of %s: %v", url, err)
+	}
+}
+
+// ResolveFailure removes a page from the crawl_failure table once it was crawled successfully.
+func ResolveFailure(s *Statements, url, stage string) {
+	if _, err := s.Exec("crawl_failure.resolve", url, stage); err != nil {
+		log.Printf("could not resolve failure of %s: %v", url, err)
+	}
+}
+
+// ListFailures returns the recorded failures, skipping the ones already tried maxAttempts times (0 means no limit).
+func ListFailures(s *Statements, maxAttempts int64) ([]CrawlFailure, error) {
+	failures := []CrawlFailure{}
+	err := s.Select(&failures, "crawl_failure.list", maxAttempts)
+	return failures, err
+}
+
+// RetryPlayerStats re-crawls a single failed player stats page of a match that is otherwise saved.
+func RetryPlayerStats(ctx context.Context, store Store, f Fetcher, failure *CrawlFailure) error {
+	m, err := store.GetMatch(failure.MatchId)
+	if err != nil {
+		return err
+	}
+	doc, err := FetchDocument(ctx, f, m.Url)
+	if err != nil {
+		return err
+	}
+
+	for _, ps := range ParsePlayerStatsOfMatch(doc, m) {
+		if ps.Url != failure.Url {
+			continue
+		}
+		if err := CrawlPlayerRawEvents(ctx, f, &ps); err != nil {
+			return err
+		}
+		return store.SavePlayerStats(&ps, m.MatchDate)
+	}
+	return fmt.Errorf("player stats %s no longer listed on %s", failure.Url, m.Url)
+}
+
+// RetryFailures re-attempts the recorded failures and returns the matches that have to be crawled again.
+// Player stats pages are retried in place, listing pages are re-crawled to collect their matches.
+func RetryFailures(ctx context.Context, store Store, f Fetcher, failures []CrawlFailure) []Match {
+	matches := make([]Match, 0)
+	leagueSeasonRe := regexp.MustCompile(`statszone/results/(\d+)-(\d+)`)
+	dateRe := regexp.MustCompile(`date_req=([\d-]+)`)
+
+	for i, _ := range failures {
+		if ctx.Err() != nil {
+			break
+		}
+		failure := &failures[i]
+		var err error
+
+		switch failure.Stage {
+		case StageSeason:
+			res := leagueSeasonRe.FindStringSubmatch(failure.Url)
+			if res == nil {
+				err = fmt.Errorf("cannot get league and season from %s", failure.Url)
+			} else {
+				err = CrawlMatchesOfSeason(ctx, f, &matches, res[2], res[1])
+			}
+		case StageDay:
+			res := dateRe.FindStringSubmatch(failure.Url)
+			if res == nil {
+				err = fmt.Errorf("cannot get date from %s", failure.Url)
+			} else {
+				err = CrawlMatchesOfDay(ctx, f, &matches, res[1])
+			}
+		case StageMatch:
+			m, getErr := store.GetMatch(failure.MatchId)
+			if getErr == sql.ErrNoRows {
+				matches = append(matches, NewMatchFromUrl(failure.Url))
+			} else if getErr != nil {
+				err = getErr
+			} else {
+				matches = append(matches, *m)
+			}
+		case StagePlayerStats:
+			err = RetryPlayerStats(ctx, store, f, failure)
+		default:
+			err = fmt.Errorf("unknown stage %q", failure.Stage)
+		}
+
+		if err != nil {
+			store.RecordFailure(failure.Url, failure.Stage, failure.MatchId, err)
+			continue
+		}
+		// match failures are resolved by the crawl of the match itself
+		if failure.Stage != StageMatch {
+			store.ResolveFailure(failure.Url, failure.Stage)
+		}
+		if failure.Stage == StagePlayerStats {
+			if err := store.MarkMatchCrawled(failure.MatchId); err != nil {
+				log.Printf("could not mark match %s crawled: %v", failure.MatchId, err)
+			}
+		}
+	}
+	return matches
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/time/rate"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fetcher returns the raw html of a page. All crawl steps go through a Fetcher instead of hitting the site directly,
+// so pages can be cached on disk and replayed later without network access.
+type Fetcher interface {
+	Fetch(ctx context.Context, url string) ([]byte, error)
+}
+
+var ErrNotCached = errors.New("page is not in the cache")
+
+// FetchDocument fetches url with f and parses it into a goquery document.
+func FetchDocument(ctx context.Context, f Fetcher, url string) (*goquery.Document, error) {
+	body, err := f.Fetch(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return goquery.NewDocumentFromReader(bytes.NewReader(body))
+}
+
+// StripFragment drops the "#anchor" part of a url, which is never sent to the server.
+func StripFragment(url string) string {
+	if i := strings.Index(url, "#"); i >= 0 {
+		return url[:i]
+	}
+	return url
+}
+
+// HttpFetcher downloads pages from the live site. All requests wait on one shared Limiter, so the request rate
+// does not grow with the number of crawler goroutines. Timeouts, 429 and 5xx responses are retried with
+// jittered exponential backoff, waiting at least as long as the server asks for in Retry-After.
+type HttpFetcher struct {
+	Client     *http.Client
+	Limiter    *rate.Limiter
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+func NewHttpFetcher(limiter *rate.Limiter, maxRetries int) *HttpFetcher {
+	return &HttpFetcher{
+		Client:     &http.Client{Timeout: 30 * time.Second},
+		Limiter:    limiter,
+		MaxRetries: maxRetries,
+		BaseDelay:  2 * time.Second,
+		MaxDelay:   5 * time.Minute}
+}
+
+// HttpStatusError is returned for any response other than 200 OK.
+type HttpStatusError struct {
+	Url        string
+	StatusCode int
+	Status     string
+	RetryAfter time.Duration
+}
+
+func (e *HttpStatusError) Error() string {
+	return fmt.Sprintf("GET %s: %s", e.Url, e.Status)
+}
+
+func (f *HttpFetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		if f.Limiter != nil {
+			if err := f.Limiter.Wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		body, err := f.get(ctx, url)
+		if err == nil {
+			return body, nil
+		}
+		if attempt >= f.MaxRetries || !IsRetryable(err) {
+			return nil, err
+		}
+
+		delay := f.Backoff(attempt)
+		if statusErr, ok := err.(*HttpStatusError); ok && statusErr.RetryAfter > delay {
+			delay = statusErr.RetryAfter
+		}
+		fmt.Printf("retrying %s in %v: %v\n", url, delay, err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (f *HttpFetcher) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequest("GET", StripFragment(url), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HttpStatusError{
+			Url:        url,
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			RetryAfter: ParseRetryAfter(resp.Header.Get("Retry-After"))}
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// Backoff doubles BaseDelay for every failed attempt up to MaxDelay, then picks a random delay in its upper half
+// so that goroutines failing at the same time do not all come back at the same time.
+func (f *HttpFetcher) Backoff(attempt int) time.Duration {
+	delay := f.MaxDelay
+	if attempt < 30 && f.BaseDelay<<uint(attempt) < f.MaxDelay {
+		delay = f.BaseDelay << uint(attempt)
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// IsRetryable tells whether a failed request is worth another try: timeouts, 429 Too Many Requests and 5xx.
+func IsRetryable(err error) bool {
+	switch e := err.(type) {
+	case *HttpStatusError:
+		return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+	case net.Error:
+		return e.Timeout()
+	}
+	return false
+}
+
+// ParseRetryAfter reads a Retry-After header given either in seconds or as an http date.
+func ParseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// CachingFetcher keeps the raw html of every page it serves as a gzip file under Dir, keyed by the sha1 of the url.
+// Pages missing from the cache are fetched with Next; when Next is nil the fetcher only replays cached pages.
+type CachingFetcher struct {
+	Dir  string
+	Next Fetcher
+}
+
+func NewCachingFetcher(dir string, next Fetcher) *CachingFetcher {
+	return &CachingFetcher{Dir: dir, Next: next}
+}
+
+// NewReplayFetcher returns a fetcher that serves pages from dir only and never touches the network.
+func NewReplayFetcher(dir string) *CachingFetcher {
+	return &CachingFetcher{Dir: dir}
+}
+
+// CachePath is the file the page of url is stored in.
+func (f *CachingFetcher) CachePath(url string) string {
+	sum := sha1.Sum([]byte(StripFragment(url)))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(f.Dir, key[:2], key+".html.gz")
+}
+
+func (f *CachingFetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
+	path := f.CachePath(url)
+
+	body, err := readGzipFile(path)
+	if err == nil {
+		return body, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if f.Next == nil {
+		return nil, fmt.Errorf("%s: %w", url, ErrNotCached)
+	}
+
+	body, err = f.Next.Fetch(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeGzipFile(path, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func readGzipFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// writeGzipFile writes to a temp file first so that a crash never leaves a truncated page in the cache.
+func writeGzipFile(path string, body []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := gzip.NewWriter(tmp)
+	if _, err := w.Write(body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingServer serves its path as the page and counts the requests it gets.
+func countingServer(requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		fmt.Fprintf(w, "<html>%s</html>", r.URL.Path)
+	}))
+}
+
+func TestCachingFetcherReplaysCachedPages(t *testing.T) {
+	var requests int32
+	server := countingServer(&requests)
+	defer server.Close()
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	f := NewCachingFetcher(dir, NewHttpFetcher(nil, 0))
+	url := server.URL + "/statszone/8-2016/matches/861744/player-stats"
+	for i := 0; i < 2; i++ {
+		body, err := f.Fetch(ctx, url+"#tab")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != "<html>/statszone/8-2016/matches/861744/player-stats</html>" {
+			t.Errorf("fetch %d: %q", i, body)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("%d requests for one page fetched twice, want 1", requests)
+	}
+	if _, err := os.Stat(f.CachePath(url)); err != nil {
+		t.Errorf("page is not in the cache: %v", err)
+	}
+
+	server.Close()
+	replay := NewReplayFetcher(dir)
+	if body, err := replay.Fetch(ctx, url); err != nil || !strings.Contains(string(body), "861744") {
+		t.Errorf("replay of a cached page: %q, %v", body, err)
+	}
+	if _, err := replay.Fetch(ctx, server.URL+"/statszone/8-2016/matches/861745/player-stats"); !errors.Is(err, ErrNotCached) {
+		t.Errorf("replay of a page not cached: %v, want %v", err, ErrNotCached)
+	}
+}
+
+func TestCachingFetcherDoesNotCacheFailures(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	f := NewCachingFetcher(t.TempDir(), NewHttpFetcher(nil, 3))
+	for i := 0; i < 2; i++ {
+		_, err := f.Fetch(context.Background(), server.URL+"/missing")
+		if statusErr, ok := err.(*HttpStatusError); !ok || statusErr.StatusCode != http.StatusNotFound {
+			t.Fatalf("fetch %d of a missing page: %v", i, err)
+		}
+	}
+	if requests != 2 {
+		t.Errorf("%d requests for a missing page fetched twice, want 2: a 404 is neither retried nor cached", requests)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	f := &HttpFetcher{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	for _, c := range []struct {
+		attempt int
+		delay   time.Duration // before the jitter, which keeps the upper half
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{3, 8 * time.Second},
+		{4, 10 * time.Second},
+		{40, 10 * time.Second},
+	} {
+		for i := 0; i < 100; i++ {
+			if d := f.Backoff(c.attempt); d < c.delay/2 || d > c.delay {
+				t.Fatalf("Backoff(%d) = %v, want between %v and %v", c.attempt, d, c.delay/2, c.delay)
+			}
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	for _, c := range []struct {
+		value    string
+		min, max time.Duration
+	}{
+		{"", 0, 0},
+		{"120", 120 * time.Second, 120 * time.Second},
+		{"0", 0, 0},
+		{"-5", 0, 0},
+		{"soon", 0, 0},
+		{time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), 59 * time.Minute, time.Hour},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, 0},
+	} {
+		if d := ParseRetryAfter(c.value); d < c.min || d > c.max {
+			t.Errorf("ParseRetryAfter(%q) = %v, want between %v and %v", c.value, d, c.min, c.max)
+		}
+	}
+}
+
+func TestHttpFetcherRetries(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		statuses []int // of the responses before a 200
+		retries  int
+		requests int32
+		ok       bool
+	}{
+		{"429 then ok", []int{http.StatusTooManyRequests}, 3, 2, true},
+		{"5xx then ok", []int{http.StatusServiceUnavailable, http.StatusBadGateway}, 3, 3, true},
+		{"out of retries", []int{500, 500, 500}, 2, 3, false},
+		{"404 is not retried", []int{http.StatusNotFound}, 3, 1, false},
+	} {
+		var requests int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if n := int(atomic.AddInt32(&requests, 1)); n <= len(c.statuses) {
+				w.WriteHeader(c.statuses[n-1])
+				return
+			}
+			fmt.Fprint(w, "ok")
+		}))
+		f := NewHttpFetcher(nil, c.retries)
+		f.BaseDelay, f.MaxDelay = time.Millisecond, 10*time.Millisecond
+		body, err := f.Fetch(context.Background(), server.URL)
+		server.Close()
+
+		if (err == nil) != c.ok || c.ok && string(body) != "ok" {
+			t.Errorf("%s: Fetch = %q, %v", c.name, body, err)
+		}
+		if requests != c.requests {
+			t.Errorf("%s: %d requests, want %d", c.name, requests, c.requests)
+		}
+	}
+}
+
+func TestHttpFetcherHonoursRetryAfter(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	f := NewHttpFetcher(nil, 1)
+	f.BaseDelay, f.MaxDelay = time.Millisecond, 10*time.Millisecond
+	start := time.Now()
+	if _, err := f.Fetch(context.Background(), server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited < time.Second {
+		t.Errorf("retried after %v, the server asked for 1s", waited)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestStore opens a migrated SQLite store in a temporary directory, closed when the test ends.
+func newTestStore(t *testing.T) Store {
+	t.Helper()
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if _, err := store.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// testMatch returns a match between home and away with players players per team, each with a few events.
+func testMatch(id, home, away string, players int) (*Match, []*PlayerStats) {
+	date := time.Date(2016, 8, 13, 0, 0, 0, 0, time.UTC)
+	m := &Match{
+		Id:           id,
+		LeagueId:     "8",
+		Season:       2016,
+		MatchDate:    &date,
+		MatchTime:    "15:00",
+		HomeTeamName: home,
+		AwayTeamName: away,
+		HomeScore:    2,
+		AwayScore:    1,
+		Url:          fmt.Sprintf("%s/statszone/8-2016/matches/%s/player-stats", PREFIX, id)}
+
+	playerStatsArray := make([]*PlayerStats, 0, 2*players)
+	for i := 0; i < 2*players; i++ {
+		team := home
+		if i >= players {
+			team = away
+		}
+		playerId := fmt.Sprintf("%s%02d", id, i)
+		events := []PlayerEvent{
+			{EventHalf: 1, EventMinute: 10 + i, EventType: "pass_success", RawType: "smallblue", StartPoint: Point{100, 200}, EndPoint: Point{300, 250}},
+			{EventHalf: 2, EventMinute: 60, EventType: "pass_success", RawType: "smallblue", StartPoint: Point{400, 100}, EndPoint: Point{500, 120}}}
+		playerStatsArray = append(playerStatsArray, &PlayerStats{
+			MatchId:      id,
+			TeamName:     team,
+			PlayerId:     playerId,
+			PlayerName:   fmt.Sprintf("Player %s", playerId),
+			IsSubstitute: i%players >= 11,
+			Url:          fmt.Sprintf("%s/statszone/8-2016/matches/%s/player-stats/%s/OVERALL_02", PREFIX, id, playerId),
+			Events:       &events})
+	}
+	return m, playerStatsArray
+}
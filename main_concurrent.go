@@ -1,12 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/PuerkitoBio/goquery"
-	"github.com/jmoiron/sqlx"
-	_ "github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
-	"log"
+	"os"
 	"regexp"
 	"strconv"
 	"strings"
@@ -15,22 +14,25 @@ import (
 
 var PREFIX = "http://www.fourfourtwo.com"
 
-//var NUM_MATCH_CRAWLER = 3
+var NUM_MATCH_CRAWLER = 3
 var NUM_PLAYER_STATS_CRAWLER = 10
 
 // Match is the overview information about match, not the stats / details in a match.
+// MatchDate is nil for matches crawled from their url alone, see NewMatchFromUrl.
 type Match struct {
-	Id           string `db:"id"`
-	Season       string `db:"season"`
-	MatchDate    string `db:"match_date"`
-	MatchTime    string `db:"match_time"`
-	LeagueId     string `db:"league_id"`
-	HomeTeamName string `db:"home_team_name"`
-	AwayTeamName string `db:"away_team_name"`
-	HomeScore    string `db:"home_score"`
-	AwayScore    string `db:"away_score"`
-	Url          string `db:"url"`
-	IsCrawled    string `db:"is_crawled"`
+	Id           string     `db:"id"`
+	Season       int        `db:"season"`
+	MatchDate    *time.Time `db:"match_date"`
+	MatchTime    string     `db:"match_time"`
+	LeagueId     string     `db:"league_id"`
+	HomeTeamName string     `db:"home_team_name"`
+	AwayTeamName string     `db:"away_team_name"`
+	HomeTeamId   *int64     `db:"home_team_id"`
+	AwayTeamId   *int64     `db:"away_team_id"`
+	HomeScore    int        `db:"home_score"`
+	AwayScore    int        `db:"away_score"`
+	Url          string     `db:"url"`
+	IsCrawled    bool       `db:"is_crawled"`
 }
 
 type League struct {
@@ -38,20 +40,31 @@ type League struct {
 	Name string `db:"name"`
 }
 
+// Player is the canonical record of a player: the name they were last seen under and the dates of their first and
+// last match. Every name they were listed under is kept in the player_name table.
 type Player struct {
-	Id   string `db:"id"`
-	Name string `db:"name"`
+	Id        string     `db:"id"`
+	Name      string     `db:"name"`
+	FirstSeen *time.Time `db:"first_seen"`
+	LastSeen  *time.Time `db:"last_seen"`
 }
 
+// MinuteOn, MinuteOff and MinutesPlayed are nil for player stats crawled before substitutions were parsed, and for
+// substitutes whose substitution was not found on the match page, see setMinutes.
 type PlayerStats struct {
-	Id           int64  `db:id`
-	MatchId      string `db:"match_id"`
-	TeamName     string `db:"team_name"`
-	PlayerId     string `db:"player_id"`
-	PlayerName   string `db:"player_name"`
-	IsSubstitute string `db:"is_substitute"`
-	Url          string `db:"url"`
-	Events       *[]PlayerEvent
+	Id            int64  `db:"id"`
+	MatchId       string `db:"match_id"`
+	TeamName      string `db:"team_name"`
+	TeamId        *int64 `db:"team_id"`
+	PlayerId      string `db:"player_id"`
+	PlayerName    string `db:"player_name"`
+	IsSubstitute  bool   `db:"is_substitute"`
+	MinuteOn      *int   `db:"minute_on"`
+	MinuteOff     *int   `db:"minute_off"`
+	MinutesPlayed *int   `db:"minutes_played"`
+	SentOff       bool   `db:"sent_off"`
+	Url           string `db:"url"`
+	Events        *[]PlayerEvent
 }
 
 type Point struct {
@@ -59,12 +72,20 @@ type Point struct {
 }
 
 // If the event has no directions, then the startPoint would store the position of this event, leaving endPoint empty.
-// Pitch range is from (57, 58) to (680, 470) in the raw D3 position, need to transform it.
+// StartPoint and EndPoint are in the raw D3 frame of the page; PitchStart and PitchEnd are the same points in metres
+// on the standard pitch with the player's team attacking right, see ToPitch and NormalizeEvent.
+// RawType is the marker or icon name the event was drawn with, which EventTypeMap maps to EventType.
+// Category, Outcome and Qualifiers place EventType in the EventTaxonomy.
 type PlayerEvent struct {
-	EventHalf            string `db:"event_half"`
-	EventMinute          string `db:"event_minute"`
-	EventType            string `db:"event_type"`
+	EventHalf            int           `db:"event_half"`
+	EventMinute          int           `db:"event_minute"`
+	EventType            string        `db:"event_type"`
+	RawType              string        `db:"raw_type"`
+	Category             EventCategory `db:"category"`
+	Outcome              EventOutcome  `db:"outcome"`
+	Qualifiers           []string
 	StartPoint, EndPoint Point
+	PitchStart, PitchEnd Point
 }
 
 var MonthMap = map[string]string{
@@ -81,6 +102,8 @@ var MonthMap = map[string]string{
 	"November":  "11",
 	"December":  "12"}
 
+// EventTypeMap maps the raw marker and icon names of the statszone pages to event types. These are the built-in
+// types; more can be added or overridden with LoadEventTypeMap.
 var EventTypeMap = map[string]string{
 	"smallblue":               "pass_success",
 	"smallred":                "pass_fail",
@@ -117,24 +140,32 @@ var EventTypeMap = map[string]string{
 //	return vsf
 //}
 
-func ConstructDate(season, day, month string) string {
+func ConstructDate(season, day, month string) (time.Time, error) {
 	seasonInt, err := strconv.Atoi(season)
 	if err != nil {
-		log.Fatal(err)
+		return time.Time{}, err
 	}
 	seasonPlus := strconv.Itoa(seasonInt + 1)
 
 	if month == "08" || month == "09" || month == "10" || month == "11" || month == "12" {
-		return fmt.Sprintf("%s-%s-%s", season, month, day)
+		return time.Parse("2006-01-02", fmt.Sprintf("%s-%s-%02s", season, month, day))
 	} else {
-		return fmt.Sprintf("%s-%s-%s", seasonPlus, month, day)
+		return time.Parse("2006-01-02", fmt.Sprintf("%s-%s-%02s", seasonPlus, month, day))
 	}
 }
 
-func ToDigitDateFormat(season, strDate string) string {
+// ParseSeasonDate parses a date caption of the season results page such as "Saturday 13th August 2016".
+func ParseSeasonDate(season, strDate string) (time.Time, error) {
 	dateElements := strings.Split(strDate, " ")
+	if len(dateElements) < 3 {
+		return time.Time{}, fmt.Errorf("unexpected date %q", strDate)
+	}
+	month, ok := MonthMap[dateElements[2]]
+	if !ok {
+		return time.Time{}, fmt.Errorf("unknown month in date %q", strDate)
+	}
 	re := regexp.MustCompile(`[^0-9]`)
-	day, month := re.ReplaceAllString(dateElements[1], ""), MonthMap[dateElements[2]]
+	day := re.ReplaceAllString(dateElements[1], "")
 	return ConstructDate(season, day, month)
 }
 
@@ -166,293 +197,575 @@ func GetIdFromPlayerStatsUrl(playerStatsUrl string) string {
 	return GetIdGeneric(playerStatsUrl, `statszone/.*/matches/.*/player-stats/(\d+).*`)
 }
 
-func GetEventTime(eventTimeStr string) (string, string) {
+func GetEventTime(eventTimeStr string) (half, minute int, err error) {
 	re := regexp.MustCompile(`timer-(\d)-(\d+)`)
 	res := re.FindStringSubmatch(eventTimeStr)
-	return res[1], res[2]
+	if len(res) < 3 {
+		return 0, 0, fmt.Errorf("no event time in class %q", eventTimeStr)
+	}
+	if half, err = strconv.Atoi(res[1]); err != nil {
+		return
+	}
+	minute, err = strconv.Atoi(res[2])
+	return
 }
 
-func GetPos(s *goquery.Selection, attr string) float64 {
+func GetPos(s *goquery.Selection, attr string) (float64, error) {
 	pos := s.AttrOr(attr, "-1.0")
 	flt_pos, err := strconv.ParseFloat(pos, 64)
 	if err != nil {
-		log.Fatal(err)
+		return 0, fmt.Errorf("bad %s attribute %q: %v", attr, pos, err)
 	}
-	return flt_pos
+	return flt_pos, nil
 }
 
-func GetSinglePoint(s *goquery.Selection) Point {
-	return Point{x: GetPos(s, "x"), y: GetPos(s, "y")}
+func GetSinglePoint(s *goquery.Selection) (p Point, err error) {
+	if p.x, err = GetPos(s, "x"); err != nil {
+		return
+	}
+	p.y, err = GetPos(s, "y")
+	return
 }
 
-func GetStartEndPoints(s *goquery.Selection) (p1, p2 Point) {
-	p1 = Point{x: GetPos(s, "x1"), y: GetPos(s, "y1")}
-	p2 = Point{x: GetPos(s, "x2"), y: GetPos(s, "y2")}
+func GetStartEndPoints(s *goquery.Selection) (p1, p2 Point, err error) {
+	for _, c := range []struct {
+		v    *float64
+		attr string
+	}{{&p1.x, "x1"}, {&p1.y, "y1"}, {&p2.x, "x2"}, {&p2.y, "y2"}} {
+		if *c.v, err = GetPos(s, c.attr); err != nil {
+			return
+		}
+	}
 	return
 }
 
-func ConcurrentCheckMatchExistsInDB(db *sqlx.DB, match *Match, ch chan<- *Match) {
+// IsMatchCrawled tells whether a match was already crawled completely.
+func IsMatchCrawled(s *Statements, match *Match) (bool, error) {
 	var count int64
-	err := db.Get(&count, fmt.Sprintf(`SELECT count(*) FROM match where url = "%s"`, match.Url))
-	fmt.Printf("%s (%d)\n", match.Url, count)
+	err := s.Get(&count, "match.crawled", match.Url, true)
 	if err != nil {
-		log.Fatal(err)
+		return false, err
 	}
-	if count == 0 {
-		ch <- match
+	return count > 0, nil
+}
+
+// ListUncrawledMatches returns the matches whose crawl was interrupted before all players were processed.
+func ListUncrawledMatches(s *Statements) ([]Match, error) {
+	matches := []Match{}
+	err := s.Select(&matches, "match.uncrawled", false)
+	return matches, err
+}
+
+// GetMatch loads a single match row, returning sql.ErrNoRows if it was never saved.
+func GetMatch(s *Statements, matchId string) (*Match, error) {
+	m := Match{}
+	err := s.Get(&m, "match.get", matchId)
+	if err != nil {
+		return nil, err
 	}
+	return &m, nil
 }
 
-func CrawlMatch(matches *[]Match, date string, matchRow *goquery.Selection) {
+// deleteStalePlayerStats removes the player stats of a match, and their events, that are not in keep, e.g. those of
+// players an earlier crawl listed by mistake.
+func deleteStalePlayerStats(s *Statements, matchId string, keep map[int64]bool) error {
+	ids := []int64{}
+	if err := s.Select(&ids, "player_stats.ids_by_match", matchId); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if keep[id] {
+			continue
+		}
+		if _, err := s.Exec("player_event.delete", id); err != nil {
+			return err
+		}
+		if _, err := s.Exec("player_stats.delete", id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func CrawlMatch(matches *[]Match, date time.Time, matchRow *goquery.Selection) error {
 	time := matchRow.Find(".time").Text()
-	homeTeam := matchRow.Find(".home-team").Text()
-	awayTeam := matchRow.Find(".away-team").Text()
-	scores := strings.Split(matchRow.Find(".score").Text(), " - ")
+	homeTeam := NormalizeTeamName(matchRow.Find(".home-team").Text())
+	awayTeam := NormalizeTeamName(matchRow.Find(".away-team").Text())
+	scoreText := matchRow.Find(".score").Text()
+	scores := strings.Split(scoreText, " - ")
 	url, _ := matchRow.Find(".link-to-match a").Attr("href")
+	if len(scores) != 2 {
+		return fmt.Errorf("%s: unexpected score %q", url, scoreText)
+	}
+	homeScore, err := strconv.Atoi(strings.TrimSpace(scores[0]))
+	if err != nil {
+		return fmt.Errorf("%s: unexpected score %q", url, scoreText)
+	}
+	awayScore, err := strconv.Atoi(strings.TrimSpace(scores[1]))
+	if err != nil {
+		return fmt.Errorf("%s: unexpected score %q", url, scoreText)
+	}
 	leagueId, season := GetLeagueIdAndSeasonFromMatchUrl(url)
+	seasonInt, _ := strconv.Atoi(season)
 
 	match := Match{
 		Id:           GetIdFromMatchUrl(url),
 		LeagueId:     leagueId,
-		Season:       season,
-		MatchDate:    date,
+		Season:       seasonInt,
+		MatchDate:    &date,
 		MatchTime:    time,
 		HomeTeamName: homeTeam,
 		AwayTeamName: awayTeam,
-		HomeScore:    scores[0],
-		AwayScore:    scores[1],
+		HomeScore:    homeScore,
+		AwayScore:    awayScore,
 		Url:          PREFIX + url + "/player-stats#tabs-wrapper-anchor"}
 
 	*matches = append(*matches, match)
+	return nil
+}
+
+// NewMatchFromUrl builds a Match from a single match url, either relative or absolute.
+// Only the ids can be recovered from the url; date, teams and scores are left empty.
+func NewMatchFromUrl(matchUrl string) Match {
+	url := strings.TrimPrefix(matchUrl, PREFIX)
+	if i := strings.Index(url, "/player-stats"); i >= 0 {
+		url = url[:i]
+	}
+	leagueId, season := GetLeagueIdAndSeasonFromMatchUrl(url)
+	seasonInt, _ := strconv.Atoi(season)
+
+	return Match{
+		Id:       GetIdFromMatchUrl(url),
+		LeagueId: leagueId,
+		Season:   seasonInt,
+		Url:      PREFIX + url + "/player-stats#tabs-wrapper-anchor"}
+}
+
+// ListingError lists the rows of a season or day listing that could not be read, such as a postponed match without
+// a score. The matches of all other rows are collected all the same.
+type ListingError []error
+
+func (e ListingError) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// add appends the rows of err to e, err being a ListingError or the error of a single row.
+func (e *ListingError) add(err error) {
+	if rows, ok := err.(ListingError); ok {
+		*e = append(*e, rows...)
+	} else if err != nil {
+		*e = append(*e, err)
+	}
+}
+
+// result is e as an error, nil if no row failed.
+func (e ListingError) result() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
 }
 
-func CrawlMatchByLeague(matches *[]Match, date string, leagueTable *goquery.Selection) {
+func CrawlMatchByLeague(matches *[]Match, date time.Time, leagueTable *goquery.Selection) error {
+	var failed ListingError
 	leagueTable.Find("tbody .link").Each(func(i int, s *goquery.Selection) {
-		CrawlMatch(matches, date, s)
+		failed.add(CrawlMatch(matches, date, s))
 	})
+	return failed.result()
+}
+
+func DayUrl(date string) string {
+	return "http://www.fourfourtwo.com/statszone?date_req=" + date
+}
+
+func SeasonUrl(season, leagueId string) string {
+	return fmt.Sprintf("%s/statszone/results/%s-%s", PREFIX, leagueId, season)
 }
 
-func CrawlMatchesOfDay(matches *[]Match, date string) {
-	seedUrl := "http://www.fourfourtwo.com/statszone?date_req=" + date
-	doc, err := goquery.NewDocument(seedUrl)
+// CrawlMatchesOfDay collects the matches listed for a day. Rows that cannot be read are skipped and returned as a
+// ListingError, after the matches of the others were collected.
+func CrawlMatchesOfDay(ctx context.Context, f Fetcher, matches *[]Match, date string) error {
+	matchDate, err := time.Parse("2006-01-02", date)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	doc, err := FetchDocument(ctx, f, DayUrl(date))
+	if err != nil {
+		return err
 	}
 
+	var failed ListingError
 	doc.Find(".match-table").Each(func(i int, s *goquery.Selection) {
-		CrawlMatchByLeague(matches, date, s)
+		failed.add(CrawlMatchByLeague(matches, matchDate, s))
 	})
+	return failed.result()
 }
 
-func CrawlMatchesOfSeason(matches *[]Match, season, leagueId string) {
-	seasonResultsUrl := fmt.Sprintf("%s/statszone/results/%s-%s", PREFIX, leagueId, season)
-	doc, err := goquery.NewDocument(seasonResultsUrl)
+// CrawlMatchesOfSeason collects the matches listed for a league season, skipping the rows that cannot be read
+// like CrawlMatchesOfDay.
+func CrawlMatchesOfSeason(ctx context.Context, f Fetcher, matches *[]Match, season, leagueId string) error {
+	doc, err := FetchDocument(ctx, f, SeasonUrl(season, leagueId))
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
+	var failed ListingError
 	doc.Find(".match-table").Each(func(i int, s1 *goquery.Selection) {
-		date := s1.Find("caption span").Text()
-		s1.Find("tbody .link").Each(func(i int, s2 *goquery.Selection) {
-			CrawlMatch(matches, ToDigitDateFormat(season, date), s2)
-		})
+		date, err := ParseSeasonDate(season, s1.Find("caption span").Text())
+		if err != nil {
+			failed.add(err)
+			return
+		}
+		failed.add(CrawlMatchByLeague(matches, date, s1))
 	})
+	return failed.result()
 }
 
-func ConcurrentProcessMatches(matches *[]Match, db *sqlx.DB, maxPlayerStatsId *int64, ch chan *PlayerStats, ch2 chan *PlayerStats) {
-	mch := make(chan *Match)
-	go ConcurrentCrawlPlayerStatsOfMatch(db, maxPlayerStatsId, mch, ch, ch2)
-	for i, _ := range *matches {
-		m := (*matches)[i]
-		go ConcurrentCheckMatchExistsInDB(db, &m, mch)
-	}
+// playerStatsWriter saves player stats and their events through the statements of a transaction, and records the
+// player in the player registry. Rows are upserted on their natural keys, so saving a player again updates them in
+// place and keeps their ids.
+type playerStatsWriter struct {
+	s        *Statements
+	registry *playerRegistryWriter
 }
 
-func ConcurrentCrawlPlayerEventsOfPlayerStats(db *sqlx.DB, playerStats *PlayerStats, ch chan<- *PlayerStats, ch2 <-chan *PlayerStats) {
-	q := `INSERT INTO player_stats (match_id, team_name, player_id, player_name, is_substitute, url)
-			VALUES (:match_id, :team_name, :player_id, :player_name, :is_substitute, :url)`
-	ch <- playerStats
-	finishedPlayerStats := <-ch2
+func newPlayerStatsWriter(s *Statements) *playerStatsWriter {
+	return &playerStatsWriter{s, newPlayerRegistryWriter(s)}
+}
 
-	// Save player events to DB
-	for i, _ := range *finishedPlayerStats.Events {
-		e := (*finishedPlayerStats.Events)[i]
-		go ConcurrentSavePlayerEvents(db, playerStats, &e)
+// Write upserts ps, taking the id the database assigned to it, and links its events to that id.
+// matchDate is the date of the match ps belongs to, used for the first and last seen dates of the player.
+func (w *playerStatsWriter) Write(ps *PlayerStats, matchDate *time.Time) error {
+	if err := w.registry.Write(ps, matchDate); err != nil {
+		return err
 	}
-
-	// Save player stats to DB
-	_, err := db.NamedExec(q, *finishedPlayerStats)
+	stmt, err := w.s.Stmt("player_stats.upsert")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	err = stmt.QueryRowx(ps.MatchId, ps.TeamName, ps.TeamId, ps.PlayerId, ps.PlayerName, ps.IsSubstitute,
+		ps.MinuteOn, ps.MinuteOff, ps.MinutesPlayed, ps.SentOff, ps.Url).Scan(&ps.Id)
+	if err != nil {
+		return err
+	}
+	return w.WriteEvents(ps)
 }
 
-func ConcurrentCrawlPlayerStatsOfMatch(db *sqlx.DB, maxPlayerStatsId *int64, mch <-chan *Match, ch chan *PlayerStats, ch2 chan *PlayerStats) {
-	mq := `INSERT INTO match (id, season, match_date, match_time, league_id, home_team_name, away_team_name, home_score, away_score, url, is_crawled)
-			VALUES (:id, :season, :match_date, :match_time, :league_id, :home_team_name, :away_team_name, :home_score, :away_score, :url, "0")`
-	for {
-		m := <-mch
+// eventKey is the natural key of an event within its player stats, together with its ordinal.
+type eventKey struct {
+	half, minute         int
+	rawType              string
+	startPoint, endPoint Point
+}
 
-		_, err := db.NamedExec(mq, m)
+// WriteEvents upserts the events of ps, which has to be saved already, and removes the events of ps saved before
+// that are no longer there. Identical events are told apart by the order they appear in.
+func (w *playerStatsWriter) WriteEvents(ps *PlayerStats) error {
+	stmt, err := w.s.Stmt("player_event.upsert")
+	if err != nil {
+		return err
+	}
+	ordinals := make(map[eventKey]int)
+	keep := make(map[int64]bool)
+	for _, e := range *ps.Events {
+		key := eventKey{e.EventHalf, e.EventMinute, e.RawType, e.StartPoint, e.EndPoint}
+		var id int64
+		err := stmt.QueryRowx(ps.Id, e.EventHalf, e.EventMinute, e.EventType, e.RawType,
+			string(e.Category), string(e.Outcome), JoinQualifiers(e.Qualifiers), e.StartPoint.x, e.StartPoint.y, e.EndPoint.x, e.EndPoint.y,
+			e.PitchStart.x, e.PitchStart.y, e.PitchEnd.x, e.PitchEnd.y, ordinals[key]).Scan(&id)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
+		ordinals[key]++
+		keep[id] = true
+	}
 
-		fmt.Printf("[%s] %s\n", m.Id, m.Url)
-		doc, err := goquery.NewDocument(m.Url)
-		if err != nil {
-			log.Fatal(err)
+	ids := []int64{}
+	if err := w.s.Select(&ids, "player_event.ids", ps.Id); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if keep[id] {
+			continue
 		}
-		playerStatsArray := make([]PlayerStats, 0)
-
-		// crawl starting sqaud
-		doc.Find(".lineup").Each(func(i int, s *goquery.Selection) {
-			classText, _ := s.Attr("class")
+		if _, err := w.s.Exec("player_event.delete_by_id", id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-			var teamName string
-			if homeOrAway := classText[7:]; homeOrAway == "home" {
-				teamName = m.HomeTeamName
-			} else {
-				teamName = m.AwayTeamName
-			}
+// SaveListedMatch saves a match with the teams, date and score of the season or day listing it was found on, and
+// flags it not crawled. It is saved before the match page is fetched, so a match whose page fails keeps what the
+// listing said about it, and is retried and resumed like any other.
+func SaveListedMatch(s *Statements, m *Match) error {
+	tx, ts, err := s.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-			playerStatsUrl, _ := s.Find("span a").Attr("href")
-			emptyEventArray := make([]PlayerEvent, 0)
-			playerStats := PlayerStats{
-				Id:           *maxPlayerStatsId + 1,
-				MatchId:      m.Id,
-				TeamName:     teamName,
-				PlayerId:     GetIdFromPlayerStatsUrl(playerStatsUrl),
-				IsSubstitute: "0",
-				Url:          PREFIX + playerStatsUrl,
-				Events:       &emptyEventArray}
-			*maxPlayerStatsId++
-			playerStatsArray = append(playerStatsArray, playerStats)
-		})
+	if err := resolveMatchTeams(newTeamResolver(ts), m, nil); err != nil {
+		return err
+	}
+	m.IsCrawled = false
+	_, err = ts.Exec("match.upsert", m.Id, m.Season, m.MatchDate, m.MatchTime, m.LeagueId, m.HomeTeamName, m.AwayTeamName,
+		m.HomeTeamId, m.AwayTeamId, m.HomeScore, m.AwayScore, m.Url, m.IsCrawled)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
 
-		// crawl substitution
-		doc.Find("#substitutes .subs").Each(func(i int, s1 *goquery.Selection) {
-			classText, _ := s1.Attr("class")
+// SaveMatch replaces everything stored for a match with its match row, player stats and events in one
+// transaction, so a match is either fully saved or not at all. Rows saved by an earlier crawl are updated in place,
+// and those no longer on the match page removed. The match is flagged crawled only if complete.
+func SaveMatch(s *Statements, m *Match, playerStatsArray []*PlayerStats, complete bool) error {
+	tx, ts, err := s.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-			var teamName string
-			if homeOrAway := classText[:4]; homeOrAway == "home" {
-				teamName = m.HomeTeamName
-			} else {
-				teamName = m.AwayTeamName
-			}
+	if err := resolveMatchTeams(newTeamResolver(ts), m, playerStatsArray); err != nil {
+		return err
+	}
+	m.IsCrawled = complete
+	_, err = ts.Exec("match.upsert", m.Id, m.Season, m.MatchDate, m.MatchTime, m.LeagueId, m.HomeTeamName, m.AwayTeamName,
+		m.HomeTeamId, m.AwayTeamId, m.HomeScore, m.AwayScore, m.Url, m.IsCrawled)
+	if err != nil {
+		return err
+	}
 
-			s1.Find("li").Each(func(i int, s2 *goquery.Selection) {
-				playerStatsUrl, exists := s2.Find("div ul").Find(".first").Find("a").Attr("href")
-				if exists {
-					emptyEventArray := make([]PlayerEvent, 0)
-					playerStats := PlayerStats{
-						Id:           *maxPlayerStatsId + 1,
-						MatchId:      m.Id,
-						TeamName:     teamName,
-						PlayerId:     GetIdFromPlayerStatsUrl(playerStatsUrl),
-						IsSubstitute: "1",
-						Url:          PREFIX + playerStatsUrl,
-						Events:       &emptyEventArray}
-					*maxPlayerStatsId++
-					playerStatsArray = append(playerStatsArray, playerStats)
-				}
-			})
-		})
+	directions := PlayDirections(playerStatsArray)
+	if err := savePlayDirections(ts, m.Id, playerStatsArray, directions); err != nil {
+		return err
+	}
+	for _, ps := range playerStatsArray {
+		NormalizePlayerStats(ps, directions)
+	}
 
-		for i, _ := range playerStatsArray {
-			ps := playerStatsArray[i]
-			ConcurrentCrawlPlayerEventsOfPlayerStats(db, &ps, ch, ch2)
+	w := newPlayerStatsWriter(ts)
+	keep := make(map[int64]bool)
+	for _, ps := range playerStatsArray {
+		if err := w.Write(ps, m.MatchDate); err != nil {
+			return err
 		}
+		keep[ps.Id] = true
+	}
+	if err := deleteStalePlayerStats(ts, m.Id, keep); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
 
-		tx := db.MustBegin()
-		db.MustExec(fmt.Sprintf(`UPDATE match SET is_crawled = "1" WHERE id = "%s"`, m.Id))
-		tx.Commit()
+// SavePlayerStats replaces a single player stats row and its events, used when retrying a failed player.
+func SavePlayerStats(s *Statements, ps *PlayerStats, matchDate *time.Time) error {
+	tx, ts, err := s.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-		time.Sleep(time.Minute * 1)
+	if err := resolvePlayerStatsTeam(newTeamResolver(ts), ps); err != nil {
+		return err
 	}
+	if err := normalizeRetriedPlayerStats(ts, ps); err != nil {
+		return err
+	}
+	if err := newPlayerStatsWriter(ts).Write(ps, matchDate); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func ConcurrentSavePlayerEvents(db *sqlx.DB, ps *PlayerStats, e *PlayerEvent) {
-	q := `INSERT INTO player_event (player_stats_id, event_half, event_minute, event_type, x1, y1, x2, y2) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
-	fmt.Printf("[%s-%s] %s, (%.2f, %.2f) -> (%.2f, %.2f)\n", e.EventHalf, e.EventMinute, e.EventType, e.StartPoint.x, e.StartPoint.y, e.EndPoint.x, e.EndPoint.y)
+// SaveEvents replaces the events of player stats that are already saved, keeping the player stats row.
+func SaveEvents(s *Statements, ps *PlayerStats) error {
+	tx, ts, err := s.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	tx := db.MustBegin()
-	db.MustExec(q, ps.Id, e.EventHalf, e.EventMinute, e.EventType, e.StartPoint.x, e.StartPoint.y, e.EndPoint.x, e.EndPoint.y)
-	tx.Commit()
+	if err := newPlayerStatsWriter(ts).WriteEvents(ps); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func ConcurrentCrawlPlayerRawEvents(db *sqlx.DB, ch <-chan *PlayerStats, ch2 chan<- *PlayerStats) {
-	for {
-		playerStats := <-ch
-		fmt.Printf("[%s] %s\n", playerStats.PlayerId, playerStats.Url)
-
-		doc, err := goquery.NewDocument(playerStats.Url)
-		if err != nil {
-			log.Fatal(err)
+// ParsePlayerStatsOfMatch lists the starting squad and the substitutes who came on from a match page, with the
+// minutes they came on and went off.
+func ParsePlayerStatsOfMatch(doc *goquery.Document, m *Match) []PlayerStats {
+	playerStatsArray := make([]PlayerStats, 0)
+	subs := make([]substitution, 0)
+	redCards := make(map[string]int)
+
+	// crawl starting sqaud
+	doc.Find(".lineup").Each(func(i int, s *goquery.Selection) {
+		var teamName string
+		if s.HasClass("home") {
+			teamName = m.HomeTeamName
+		} else {
+			teamName = m.AwayTeamName
 		}
 
-		doc.Find(".pitch-object").Each(func(i int, s *goquery.Selection) {
-			class, _ := s.Attr("class")
-			half, minute := GetEventTime(class)
-			markerEnd, hasDirection := s.Attr("marker-end")
-			startPoint, endPoint := Point{-1.0, -1.0}, Point{-1.0, -1.0}
-			eventType := "unknown"
-
-			if hasDirection {
-				re := regexp.MustCompile(`url\(#(\w+)\)`)
-				rawEventType := re.FindStringSubmatch(markerEnd)
-				eventType = EventTypeMap[rawEventType[1]]
-				startPoint, endPoint = GetStartEndPoints(s)
-			} else {
-				picUrl, _ := s.Attr("href")
-				re := regexp.MustCompile(`/sites/fourfourtwo.com/modules/custom/statzone/files/icons/(\w+)\.png`)
-				rawEventType := re.FindStringSubmatch(picUrl)
-				eventType = EventTypeMap[rawEventType[1]]
-				startPoint = GetSinglePoint(s)
-				endPoint = startPoint
-			}
+		playerStatsUrl, _ := s.Find("span a").Attr("href")
+		emptyEventArray := make([]PlayerEvent, 0)
+		playerStats := PlayerStats{
+			MatchId:      m.Id,
+			TeamName:     teamName,
+			PlayerId:     GetIdFromPlayerStatsUrl(playerStatsUrl),
+			IsSubstitute: false,
+			Url:          PREFIX + playerStatsUrl,
+			Events:       &emptyEventArray}
+		playerStatsArray = append(playerStatsArray, playerStats)
+		if minute, ok := parseRedCard(s); ok {
+			redCards[playerStats.Url] = minute
+		}
+	})
 
-			event := PlayerEvent{
-				EventHalf:   half,
-				EventMinute: minute,
-				EventType:   eventType,
-				StartPoint:  startPoint,
-				EndPoint:    endPoint}
+	// crawl substitution
+	doc.Find("#substitutes .subs").Each(func(i int, s1 *goquery.Selection) {
+		var teamName string
+		if s1.HasClass("home") {
+			teamName = m.HomeTeamName
+		} else {
+			teamName = m.AwayTeamName
+		}
 
-			*playerStats.Events = append(*playerStats.Events, event)
+		s1.Find("li").Each(func(i int, s2 *goquery.Selection) {
+			playerStatsUrl, exists := s2.Find("div ul").Find(".first").Find("a").Attr("href")
+			if exists {
+				emptyEventArray := make([]PlayerEvent, 0)
+				playerStats := PlayerStats{
+					MatchId:      m.Id,
+					TeamName:     teamName,
+					PlayerId:     GetIdFromPlayerStatsUrl(playerStatsUrl),
+					IsSubstitute: true,
+					Url:          PREFIX + playerStatsUrl,
+					Events:       &emptyEventArray}
+				playerStatsArray = append(playerStatsArray, playerStats)
+				if sub, ok := parseSubstitution(s2); ok {
+					subs = append(subs, sub)
+				}
+				if minute, ok := parseRedCard(s2.Find("div ul .first")); ok {
+					redCards[playerStats.Url] = minute
+				}
+			}
 		})
+	})
 
-		playerStats.PlayerName = doc.Find("#statzone_player_header h1").Text()
-		ch2 <- playerStats
+	setMinutes(playerStatsArray, subs, redCards)
+	return playerStatsArray
+}
 
-		time.Sleep(time.Second * 1)
+// MarkMatchCrawled flags a match as complete once none of its pages are left in the crawl_failure table.
+func MarkMatchCrawled(s *Statements, matchId string) error {
+	var failures int64
+	if err := s.Get(&failures, "crawl_failure.count_by_match", matchId); err != nil {
+		return err
+	}
+	if failures > 0 {
+		return nil
 	}
+	_, err := s.Exec("match.mark_crawled", true, matchId)
+	return err
 }
 
-func main() {
-	db, err := sqlx.Connect("sqlite3", "file:fourfourtwo.db?cache=shared&mode=rwc")
-	if err != nil {
-		log.Fatalln(err)
+// ParsePlayerEvent turns one ".pitch-object" svg element of a player stats page into an event.
+// Markers and icons missing from EventTypeMap give events of UnknownEventType that keep their raw type.
+func ParsePlayerEvent(s *goquery.Selection) (event PlayerEvent, err error) {
+	class, _ := s.Attr("class")
+	if event.EventHalf, event.EventMinute, err = GetEventTime(class); err != nil {
+		return
+	}
+	markerEnd, hasDirection := s.Attr("marker-end")
+
+	if hasDirection {
+		re := regexp.MustCompile(`url\(#([\w-]+)\)`)
+		if rawEventType := re.FindStringSubmatch(markerEnd); rawEventType != nil {
+			event.RawType = rawEventType[1]
+		} else {
+			event.RawType = markerEnd
+		}
+		event.StartPoint, event.EndPoint, err = GetStartEndPoints(s)
+	} else {
+		picUrl, _ := s.Attr("href")
+		re := regexp.MustCompile(`/sites/fourfourtwo.com/modules/custom/statzone/files/icons/([\w-]+)\.png`)
+		if rawEventType := re.FindStringSubmatch(picUrl); rawEventType != nil {
+			event.RawType = rawEventType[1]
+		} else {
+			event.RawType = rawTypeFromIcon(picUrl)
+		}
+		event.StartPoint, err = GetSinglePoint(s)
+		event.EndPoint = event.StartPoint
 	}
-	defer db.Close()
 
-	var maxPlayerStatsId int64
-	err = db.Get(&maxPlayerStatsId, "SELECT max(id) FROM player_stats")
+	if event.RawType == "" || event.RawType == "." {
+		return event, fmt.Errorf("event without marker or icon: %q", class)
+	}
+	event.EventType = MapEventType(event.RawType)
+	event.Classify()
+	return
+}
 
-	matches := make([]Match, 0)
-	ch := make(chan *PlayerStats, 10)
-	ch2 := make(chan *PlayerStats, 10)
+// CrawlPlayerRawEvents fetches a player stats page and appends its events to playerStats. Pitch objects that are
+// not events, without a time, position, marker or icon, are skipped and logged rather than failing the page.
+func CrawlPlayerRawEvents(ctx context.Context, f Fetcher, playerStats *PlayerStats) error {
+	doc, err := FetchDocument(ctx, f, playerStats.Url)
+	if err != nil {
+		return err
+	}
 
-	//CrawlMatchesOfDay(&matches, "2016-09-10")
-	CrawlMatchesOfSeason(&matches, "2016", "8")
+	doc.Find(".pitch-object").Each(func(i int, s *goquery.Selection) {
+		event, err := ParsePlayerEvent(s)
+		if err != nil {
+			fmt.Printf("skipping pitch object %d of %s: %v\n", i, playerStats.Url, err)
+			return
+		}
+		*playerStats.Events = append(*playerStats.Events, event)
+	})
 
-	tmpMatches := matches[:6]
-	go ConcurrentProcessMatches(&tmpMatches, db, &maxPlayerStatsId, ch, ch2)
+	playerStats.PlayerName = strings.TrimSpace(doc.Find("#statzone_player_header h1").Text())
+	return nil
+}
 
-	for i := 1; i < NUM_PLAYER_STATS_CRAWLER; i++ {
-		go ConcurrentCrawlPlayerRawEvents(db, ch, ch2)
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
 	}
 
-	var input string
-	fmt.Scanln(&input)
+	switch os.Args[1] {
+	case "crawl":
+		runCrawl(os.Args[2:])
+	case "retry-failures":
+		runRetryFailures(os.Args[2:])
+	case "migrate":
+		runMigrate(os.Args[2:])
+	case "players":
+		runPlayers(os.Args[2:])
+	case "teams":
+		runTeams(os.Args[2:])
+	case "events":
+		runEvents(os.Args[2:])
+	case "render":
+		runRender(os.Args[2:])
+	case "shots":
+		runShots(os.Args[2:])
+	case "stats":
+		runStats(os.Args[2:])
+	case "export":
+		runExport(os.Args[2:])
+	case "help", "-h", "--help":
+		usage()
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
 }
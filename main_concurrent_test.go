@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"github.com/PuerkitoBio/goquery"
+	"strings"
+	"testing"
+)
+
+func TestCrawlMatchesOfDaySkipsUnreadableRows(t *testing.T) {
+	f := fakeFetcher{DayUrl("2016-08-13"): `<html><body><table class="match-table"><tbody>
+<tr class="link"><td class="time">12:45</td><td class="home-team">Hull</td><td class="score">P - P</td><td class="away-team">Leicester</td><td class="link-to-match"><a href="/statszone/8-2016/matches/861740">x</a></td></tr>
+<tr class="link"><td class="time">15:00</td><td class="home-team">Arsenal</td><td class="score">3 - 4</td><td class="away-team">Liverpool</td><td class="link-to-match"><a href="/statszone/8-2016/matches/861744">x</a></td></tr>
+<tr class="link"><td class="time">17:30</td><td class="home-team">Burnley</td><td class="score">v</td><td class="away-team">Swansea</td><td class="link-to-match"></td></tr>
+</tbody></table></body></html>`}
+
+	matches := []Match{}
+	err := CrawlMatchesOfDay(context.Background(), f, &matches, "2016-08-13")
+	if rows, ok := err.(ListingError); !ok || len(rows) != 2 {
+		t.Errorf("error %v, want the two rows without a score", err)
+	}
+	if len(matches) != 1 || matches[0].Id != "861744" || matches[0].HomeScore != 3 || matches[0].AwayScore != 4 {
+		t.Errorf("matches %+v, want 861744 only", matches)
+	}
+}
+
+func TestParsePlayerStatsOfMatchClasses(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<html><body>
+<div class="lineup"><span><a href="/statszone/8-2016/matches/1/player-stats/21/OVERALL_02">No Side</a></span></div>
+<div class="home lineup"><span><a href="/statszone/8-2016/matches/1/player-stats/11/OVERALL_02">Home First</a></span></div>
+<div id="substitutes">
+<div class="subs"><ul><li><div><ul><li class="first"><a href="/statszone/8-2016/matches/1/player-stats/22/OVERALL_02">No Side Sub</a></li></ul></div></li></ul></div>
+<div class="subs home"><ul><li><div><ul><li class="first"><a href="/statszone/8-2016/matches/1/player-stats/12/OVERALL_02">Home Sub</a></li></ul></div></li></ul></div>
+</div>
+</body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	players := ParsePlayerStatsOfMatch(doc, &Match{Id: "1", HomeTeamName: "Hull", AwayTeamName: "Leicester"})
+	want := map[string]string{"21": "Leicester", "11": "Hull", "22": "Leicester", "12": "Hull"}
+	if len(players) != len(want) {
+		t.Fatalf("%d players, want %d", len(players), len(want))
+	}
+	for _, ps := range players {
+		if ps.TeamName != want[ps.PlayerId] {
+			t.Errorf("player %s plays for %q, want %q", ps.PlayerId, ps.TeamName, want[ps.PlayerId])
+		}
+	}
+}
+
+func TestCrawlPlayerRawEventsSkipsUnreadablePitchObjects(t *testing.T) {
+	url := PREFIX + "/statszone/8-2016/matches/1/player-stats/11/OVERALL_02"
+	f := fakeFetcher{url: `<html><body><div id="statzone_player_header"><h1> Home Keeper </h1></div><svg>
+<line class="pitch-object timer-1-12" marker-end="url(#smallblue)" x1="100" y1="200" x2="300" y2="250"></line>
+<line class="pitch-object" marker-end="url(#smallblue)" x1="100" y1="200" x2="300" y2="250"></line>
+<line class="pitch-object timer-1-20" marker-end="url(#smallblue)" x1="100" y1="n/a" x2="300" y2="250"></line>
+<image class="pitch-object timer-2-50" href="" x="300" y="200"></image>
+<line class="pitch-object timer-2-70" marker-end="url(#smallpurple)" x1="580" y1="200" x2="680" y2="262"></line>
+</svg></body></html>`}
+
+	events := []PlayerEvent{}
+	ps := &PlayerStats{Url: url, Events: &events}
+	if err := CrawlPlayerRawEvents(context.Background(), f, ps); err != nil {
+		t.Fatal(err)
+	}
+	if ps.PlayerName != "Home Keeper" {
+		t.Errorf("player name %q", ps.PlayerName)
+	}
+	if len(events) != 2 || events[0].RawType != "smallblue" || events[1].RawType != "smallpurple" ||
+		events[1].EventType != UnknownEventType {
+		t.Errorf("events %+v, want smallblue and the unknown smallpurple", events)
+	}
+}
@@ -0,0 +1,495 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// Migration is one step of the database schema. Migrations are applied in order of Version and never edited once
+// released; a schema change is a new migration appended to Migrations. Data that cannot be migrated in SQL alone is
+// handled by Apply, which runs after Up in the same transaction.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Apply   func(tx *sqlx.Tx) error
+}
+
+// Migration 1 uses "IF NOT EXISTS" so that databases created by the old create_table program are adopted as is.
+var Migrations = []Migration{
+	{1, "initial schema", `
+CREATE TABLE IF NOT EXISTS player (
+	id varchar(8),
+	name varchar(128)
+);
+
+CREATE TABLE IF NOT EXISTS match (
+	id varchar(8),
+	season varchar(4),
+	match_date varchar(10),
+	match_time varchar(10),
+	league_id varchar(2),
+	home_team_name varchar(64),
+	away_team_name varchar(64),
+	home_score varchar(2),
+	away_score varchar(2),
+	url varchar(512),
+	is_crawled varchar(1)
+);
+
+CREATE TABLE IF NOT EXISTS league (
+	id varchar(2),
+	name varchar(32)
+);
+
+CREATE TABLE IF NOT EXISTS player_stats (
+	id integer primary key,
+	match_id varchar(8),
+	team_name varchar(64),
+	player_id varchar(8),
+	player_name varchar(128),
+	is_substitute varchar(1),
+	url varchar(512)
+);
+
+CREATE TABLE IF NOT EXISTS player_event (
+	id integer primary key,
+	player_stats_id integer,
+	event_half varchar(2),
+	event_minute varchar(3),
+	event_type varchar(32),
+	x1 float,
+	y1 float,
+	x2 float,
+	y2 float
+);
+
+CREATE TABLE IF NOT EXISTS crawl_failure (
+	id integer primary key,
+	url varchar(512),
+	stage varchar(16),
+	match_id varchar(8),
+	error text,
+	attempts integer,
+	last_attempt varchar(19),
+	UNIQUE (url, stage)
+);
+`, nil},
+	{2, "seed leagues", `
+INSERT INTO league (id, name)
+SELECT l.id, l.name FROM (
+	SELECT '23' AS id, 'La Liga' AS name
+	UNION ALL SELECT '8', 'Premier League'
+	UNION ALL SELECT '21', 'Serie A'
+	UNION ALL SELECT '22', 'Bundesliga'
+	UNION ALL SELECT '24', 'Ligue 1'
+	UNION ALL SELECT '5', 'UEFA Champions League'
+) l
+WHERE NOT EXISTS (SELECT 1 FROM league WHERE league.id = l.id);
+`, nil},
+	// Typed columns, primary keys and foreign keys. SQLite cannot change the type of a column, so every table is
+	// renamed, recreated and copied over. Duplicate match rows and orphaned player stats or events, which the
+	// untyped schema allowed, are dropped on the way.
+	{3, "typed columns and keys", `
+ALTER TABLE player RENAME TO player_v2;
+ALTER TABLE league RENAME TO league_v2;
+ALTER TABLE match RENAME TO match_v2;
+ALTER TABLE player_stats RENAME TO player_stats_v2;
+ALTER TABLE player_event RENAME TO player_event_v2;
+
+CREATE TABLE player (
+	id varchar(8) primary key,
+	name varchar(128)
+);
+
+CREATE TABLE league (
+	id varchar(2) primary key,
+	name varchar(32)
+);
+
+CREATE TABLE match (
+	id varchar(8) primary key,
+	season integer,
+	match_date date,
+	match_time varchar(10),
+	league_id varchar(2),
+	home_team_name varchar(64),
+	away_team_name varchar(64),
+	home_score integer,
+	away_score integer,
+	url varchar(512),
+	is_crawled boolean NOT NULL DEFAULT false
+);
+
+CREATE TABLE player_stats (
+	id integer primary key,
+	match_id varchar(8) REFERENCES match (id),
+	team_name varchar(64),
+	player_id varchar(8),
+	player_name varchar(128),
+	is_substitute boolean NOT NULL DEFAULT false,
+	url varchar(512)
+);
+
+CREATE TABLE player_event (
+	id integer primary key,
+	player_stats_id integer REFERENCES player_stats (id),
+	event_half integer,
+	event_minute integer,
+	event_type varchar(32),
+	x1 real,
+	y1 real,
+	x2 real,
+	y2 real
+);
+
+INSERT OR IGNORE INTO player (id, name) SELECT id, name FROM player_v2;
+INSERT OR IGNORE INTO league (id, name) SELECT id, name FROM league_v2;
+INSERT OR REPLACE INTO match
+	SELECT id, CAST(season AS integer), NULLIF(match_date, ''), match_time, league_id, home_team_name, away_team_name,
+		CAST(trim(home_score) AS integer), CAST(trim(away_score) AS integer), url, is_crawled = '1'
+	FROM match_v2 ORDER BY is_crawled;
+INSERT INTO player_stats
+	SELECT id, match_id, team_name, player_id, player_name, is_substitute = '1', url
+	FROM player_stats_v2 WHERE match_id IN (SELECT id FROM match);
+INSERT INTO player_event
+	SELECT id, player_stats_id, CAST(event_half AS integer), CAST(event_minute AS integer), event_type, x1, y1, x2, y2
+	FROM player_event_v2 WHERE player_stats_id IN (SELECT id FROM player_stats);
+
+DROP TABLE player_event_v2;
+DROP TABLE player_stats_v2;
+DROP TABLE match_v2;
+DROP TABLE league_v2;
+DROP TABLE player_v2;
+`, nil},
+	// The player registry: first and last seen dates of every player, and every name a player was listed under.
+	// Players already crawled are backfilled from player_stats.
+	{4, "player registry", `
+ALTER TABLE player ADD COLUMN first_seen date;
+ALTER TABLE player ADD COLUMN last_seen date;
+
+CREATE TABLE player_name (
+	player_id varchar(8) REFERENCES player (id),
+	name varchar(128),
+	first_seen date,
+	last_seen date,
+	PRIMARY KEY (player_id, name)
+);
+
+INSERT INTO player (id)
+	SELECT DISTINCT player_id FROM player_stats
+	WHERE player_id <> '' AND player_id NOT IN (SELECT id FROM player);
+INSERT INTO player_name (player_id, name, first_seen, last_seen)
+	SELECT ps.player_id, ps.player_name, min(m.match_date), max(m.match_date)
+	FROM player_stats ps JOIN match m ON m.id = ps.match_id
+	WHERE ps.player_id <> '' AND ps.player_name <> ''
+	GROUP BY ps.player_id, ps.player_name;
+UPDATE player SET
+	first_seen = (SELECT min(first_seen) FROM player_name WHERE player_id = player.id),
+	last_seen = (SELECT max(last_seen) FROM player_name WHERE player_id = player.id),
+	name = coalesce((SELECT name FROM player_name WHERE player_id = player.id ORDER BY last_seen DESC LIMIT 1), name);
+`, nil},
+	// Teams with stable ids. Every team name already crawled becomes a team of its own, with surrounding whitespace
+	// trimmed; duplicates such as "Man Utd" and "Manchester United" are merged with the teams command.
+	{5, "teams", `
+CREATE TABLE team (
+	id integer primary key,
+	name varchar(64) NOT NULL UNIQUE
+);
+
+CREATE TABLE team_alias (
+	alias varchar(64) primary key,
+	team_id integer NOT NULL REFERENCES team (id)
+);
+
+ALTER TABLE match ADD COLUMN home_team_id integer REFERENCES team (id);
+ALTER TABLE match ADD COLUMN away_team_id integer REFERENCES team (id);
+ALTER TABLE player_stats ADD COLUMN team_id integer REFERENCES team (id);
+
+INSERT INTO team (name)
+	SELECT DISTINCT trim(name) FROM (
+		SELECT home_team_name AS name FROM match
+		UNION SELECT away_team_name FROM match
+		UNION SELECT team_name FROM player_stats
+	) n
+	WHERE trim(name) <> ''
+	ORDER BY trim(name);
+INSERT INTO team_alias (alias, team_id) SELECT name, id FROM team;
+
+UPDATE match SET
+	home_team_name = trim(home_team_name),
+	away_team_name = trim(away_team_name),
+	home_team_id = (SELECT id FROM team WHERE name = trim(match.home_team_name)),
+	away_team_id = (SELECT id FROM team WHERE name = trim(match.away_team_name));
+UPDATE player_stats SET
+	team_name = trim(team_name),
+	team_id = (SELECT id FROM team WHERE name = trim(player_stats.team_name));
+`, nil},
+	// Event coordinates in metres on a 105x68 pitch with the player's team attacking right, next to the raw ones.
+	{6, "pitch coordinates", `
+ALTER TABLE player_event ADD COLUMN pitch_x1 real;
+ALTER TABLE player_event ADD COLUMN pitch_y1 real;
+ALTER TABLE player_event ADD COLUMN pitch_x2 real;
+ALTER TABLE player_event ADD COLUMN pitch_y2 real;
+
+CREATE TABLE play_direction (
+	match_id varchar(8) REFERENCES match (id),
+	team_id integer REFERENCES team (id),
+	event_half integer,
+	attacking_right boolean NOT NULL,
+	PRIMARY KEY (match_id, team_id, event_half)
+);
+`, backfillPitchCoordinates},
+	// The raw marker or icon name of every event. Events saved before are given the raw name of their type; those
+	// saved with an empty type, from a marker that was not mapped, are marked unknown.
+	{7, "raw event types", `
+ALTER TABLE player_event ADD COLUMN raw_type varchar(64);
+
+UPDATE player_event SET raw_type = (SELECT t.raw_type FROM (
+	SELECT 'smallblue' AS raw_type, 'pass_success' AS event_type
+	UNION ALL SELECT 'smallred', 'pass_fail'
+	UNION ALL SELECT 'smallyellow', 'pass_goal_assist'
+	UNION ALL SELECT 'smalldeepskyblue', 'pass_chance_created'
+	UNION ALL SELECT 'bigblue', 'shot_on_target'
+	UNION ALL SELECT 'bigred', 'shot_off_target'
+	UNION ALL SELECT 'bigyellow', 'shot_goal'
+	UNION ALL SELECT 'bigdarkgrey', 'shot_blocked'
+	UNION ALL SELECT 'success', 'take_on_success'
+	UNION ALL SELECT 'fail', 'take_on_fail'
+	UNION ALL SELECT 'won', 'aerial_duel_won'
+	UNION ALL SELECT 'lost', 'aerial_duel_lost'
+	UNION ALL SELECT 'commited', 'foul_commited'
+	UNION ALL SELECT 'suffered', 'foul_suffered'
+	UNION ALL SELECT 'error-leading-goal', 'error_leading_goal'
+	UNION ALL SELECT 'error-leading-shot', 'error_leading_shot'
+	UNION ALL SELECT 'successful_tackle', 'def_tackle_success'
+	UNION ALL SELECT 'failed_tackle', 'def_tackle_fail'
+	UNION ALL SELECT 'successful_clearance', 'def_clearance_success'
+	UNION ALL SELECT 'failed_clearance', 'def_clearance_fail'
+	UNION ALL SELECT 'interceptions', 'def_interception'
+	UNION ALL SELECT 'defensive-ball-recovery', 'def_ball_recovery'
+	UNION ALL SELECT 'blocks', 'def_block_shot'
+	UNION ALL SELECT 'blocks-cross', 'def_block_cross'
+) t WHERE t.event_type = player_event.event_type);
+UPDATE player_event SET event_type = 'unknown' WHERE event_type IS NULL OR event_type = '';
+`, nil},
+	// Category, outcome and qualifiers of every event, see EventTaxonomy. Events of types the taxonomy does not know
+	// are in the unknown category.
+	{8, "event taxonomy", `
+ALTER TABLE player_event ADD COLUMN category varchar(16);
+ALTER TABLE player_event ADD COLUMN outcome varchar(16);
+ALTER TABLE player_event ADD COLUMN qualifiers varchar(128);
+
+CREATE TEMPORARY TABLE event_taxonomy AS
+	SELECT 'pass_success' AS event_type, 'pass' AS category, 'success' AS outcome, '' AS qualifiers
+	UNION ALL SELECT 'pass_fail', 'pass', 'fail', ''
+	UNION ALL SELECT 'pass_goal_assist', 'pass', 'success', ',assist,'
+	UNION ALL SELECT 'pass_chance_created', 'pass', 'success', ',chance_created,'
+	UNION ALL SELECT 'shot_on_target', 'shot', 'success', ',on_target,'
+	UNION ALL SELECT 'shot_off_target', 'shot', 'fail', ',off_target,'
+	UNION ALL SELECT 'shot_goal', 'shot', 'goal', ',on_target,'
+	UNION ALL SELECT 'shot_blocked', 'shot', 'blocked', ''
+	UNION ALL SELECT 'take_on_success', 'take_on', 'success', ''
+	UNION ALL SELECT 'take_on_fail', 'take_on', 'fail', ''
+	UNION ALL SELECT 'aerial_duel_won', 'aerial', 'success', ''
+	UNION ALL SELECT 'aerial_duel_lost', 'aerial', 'fail', ''
+	UNION ALL SELECT 'foul_commited', 'foul', 'fail', ',committed,'
+	UNION ALL SELECT 'foul_suffered', 'foul', 'success', ',suffered,'
+	UNION ALL SELECT 'error_leading_goal', 'error', 'fail', ',leading_to_goal,'
+	UNION ALL SELECT 'error_leading_shot', 'error', 'fail', ',leading_to_shot,'
+	UNION ALL SELECT 'def_tackle_success', 'defensive', 'success', ',tackle,'
+	UNION ALL SELECT 'def_tackle_fail', 'defensive', 'fail', ',tackle,'
+	UNION ALL SELECT 'def_clearance_success', 'defensive', 'success', ',clearance,'
+	UNION ALL SELECT 'def_clearance_fail', 'defensive', 'fail', ',clearance,'
+	UNION ALL SELECT 'def_interception', 'defensive', 'success', ',interception,'
+	UNION ALL SELECT 'def_ball_recovery', 'defensive', 'success', ',ball_recovery,'
+	UNION ALL SELECT 'def_block_shot', 'defensive', 'success', ',shot_block,'
+	UNION ALL SELECT 'def_block_cross', 'defensive', 'success', ',cross_block,';
+
+UPDATE player_event SET
+	category = coalesce((SELECT t.category FROM event_taxonomy t WHERE t.event_type = player_event.event_type), 'unknown'),
+	outcome = coalesce((SELECT t.outcome FROM event_taxonomy t WHERE t.event_type = player_event.event_type), ''),
+	qualifiers = coalesce((SELECT t.qualifiers FROM event_taxonomy t WHERE t.event_type = player_event.event_type), '');
+
+DROP TABLE event_taxonomy;
+
+CREATE INDEX player_event_category ON player_event (category, outcome);
+`, nil},
+	// Expected goals of every shot, from the latest model fitted with "shots fit".
+	{9, "expected goals", `
+ALTER TABLE player_event ADD COLUMN xg real;
+
+CREATE TABLE xg_model (
+	id integer primary key,
+	fitted_at varchar(19),
+	shots integer,
+	goals integer,
+	intercept real,
+	distance_coef real,
+	angle_coef real
+);
+`, nil},
+	// When players came on and went off. Player stats crawled before are left NULL, as their substitution minutes
+	// are only on the match pages.
+	{10, "minutes played", `
+ALTER TABLE player_stats ADD COLUMN minute_on integer;
+ALTER TABLE player_stats ADD COLUMN minute_off integer;
+ALTER TABLE player_stats ADD COLUMN minutes_played integer;
+ALTER TABLE player_stats ADD COLUMN sent_off boolean NOT NULL DEFAULT false;
+`, nil},
+	// Natural keys, so saving a match again updates its rows in place: a player appears once per match, and an
+	// event once per player stats with its half, minute, raw type and coordinates, the ordinal telling apart identical
+	// events. The raw type is part of the key rather than the type, which changes when events are remapped. Duplicate
+	// player stats are dropped, keeping the latest, and their matches crawled again.
+	{11, "natural keys", `
+UPDATE match SET is_crawled = false WHERE id IN (
+	SELECT match_id FROM player_stats GROUP BY match_id, player_id HAVING count(*) > 1);
+DELETE FROM player_event WHERE player_stats_id IN (
+	SELECT id FROM player_stats ps WHERE EXISTS (
+		SELECT 1 FROM player_stats newer WHERE newer.match_id = ps.match_id AND newer.player_id = ps.player_id AND newer.id > ps.id));
+DELETE FROM player_stats WHERE EXISTS (
+	SELECT 1 FROM player_stats newer
+	WHERE newer.match_id = player_stats.match_id AND newer.player_id = player_stats.player_id AND newer.id > player_stats.id);
+CREATE UNIQUE INDEX player_stats_player ON player_stats (match_id, player_id);
+
+UPDATE player_event SET raw_type = '' WHERE raw_type IS NULL;
+ALTER TABLE player_event ADD COLUMN ordinal integer NOT NULL DEFAULT 0;
+CREATE INDEX player_event_player_stats ON player_event (player_stats_id);
+UPDATE player_event SET ordinal = (
+	SELECT count(*) FROM player_event e
+	WHERE e.player_stats_id = player_event.player_stats_id AND e.event_half = player_event.event_half
+		AND e.event_minute = player_event.event_minute AND e.raw_type = player_event.raw_type
+		AND e.x1 = player_event.x1 AND e.y1 = player_event.y1 AND e.x2 = player_event.x2 AND e.y2 = player_event.y2
+		AND e.id < player_event.id);
+CREATE UNIQUE INDEX player_event_key ON player_event (player_stats_id, event_half, event_minute, raw_type, x1, y1, x2, y2, ordinal);
+`, nil},
+}
+
+// postgresMigrations are the statements of the migrations whose SQLite statements do not run on PostgreSQL. All
+// other migrations run on PostgreSQL as Dialect.Translate rewrites them.
+var postgresMigrations = map[int]string{
+	// PostgreSQL can change the type of a column in place.
+	3: `
+ALTER TABLE player ADD PRIMARY KEY (id);
+ALTER TABLE league ADD PRIMARY KEY (id);
+
+ALTER TABLE match
+	ADD PRIMARY KEY (id),
+	ALTER COLUMN season TYPE integer USING CAST(NULLIF(season, '') AS integer),
+	ALTER COLUMN match_date TYPE date USING CAST(NULLIF(match_date, '') AS date),
+	ALTER COLUMN home_score TYPE integer USING CAST(NULLIF(trim(home_score), '') AS integer),
+	ALTER COLUMN away_score TYPE integer USING CAST(NULLIF(trim(away_score), '') AS integer),
+	ALTER COLUMN is_crawled TYPE boolean USING coalesce(is_crawled = '1', false),
+	ALTER COLUMN is_crawled SET DEFAULT false,
+	ALTER COLUMN is_crawled SET NOT NULL;
+
+ALTER TABLE player_stats
+	ALTER COLUMN is_substitute TYPE boolean USING coalesce(is_substitute = '1', false),
+	ALTER COLUMN is_substitute SET DEFAULT false,
+	ALTER COLUMN is_substitute SET NOT NULL,
+	ADD FOREIGN KEY (match_id) REFERENCES match (id);
+
+ALTER TABLE player_event
+	ALTER COLUMN event_half TYPE integer USING CAST(NULLIF(event_half, '') AS integer),
+	ALTER COLUMN event_minute TYPE integer USING CAST(NULLIF(event_minute, '') AS integer),
+	ADD FOREIGN KEY (player_stats_id) REFERENCES player_stats (id);
+`,
+}
+
+// Statements returns the statements of the migration in the dialect of the database it is applied to.
+func (m Migration) Statements(dialect Dialect) string {
+	if up, ok := postgresMigrations[m.Version]; ok && dialect == Postgres {
+		return up
+	}
+	return dialect.Translate(m.Up)
+}
+
+var schemaVersionTable = `
+CREATE TABLE IF NOT EXISTS schema_version (
+	version integer primary key,
+	name varchar(64),
+	applied_at varchar(19)
+);
+`
+
+// MigrationStatus is a migration together with the time it was applied, empty if it is still pending.
+type MigrationStatus struct {
+	Migration
+	AppliedAt string
+}
+
+func appliedMigrations(db *sqlx.DB) (map[int]string, error) {
+	if _, err := db.Exec(schemaVersionTable); err != nil {
+		return nil, err
+	}
+	rows := []struct {
+		Version   int    `db:"version"`
+		AppliedAt string `db:"applied_at"`
+	}{}
+	if err := db.Select(&rows, `SELECT version, applied_at FROM schema_version`); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]string)
+	for _, r := range rows {
+		applied[r.Version] = r.AppliedAt
+	}
+	return applied, nil
+}
+
+// Migrate applies every pending migration, each in its own transaction, and returns the ones it applied.
+func Migrate(db *sqlx.DB, dialect Dialect) ([]Migration, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make([]Migration, 0)
+	for _, m := range Migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := applyMigration(db, dialect, m); err != nil {
+			return done, fmt.Errorf("migration %d (%s): %v", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+func applyMigration(db *sqlx.DB, dialect Dialect, m Migration) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(m.Statements(dialect)); err != nil {
+		return err
+	}
+	if m.Apply != nil {
+		if err := m.Apply(tx); err != nil {
+			return err
+		}
+	}
+	now := time.Now().UTC().Format("2006-01-02 15:04:05")
+	if _, err := tx.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES ($1, $2, $3)`, m.Version, m.Name, now); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MigrationsStatus lists all known migrations and when they were applied.
+func MigrationsStatus(db *sqlx.DB) ([]MigrationStatus, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, 0, len(Migrations))
+	for _, m := range Migrations {
+		status = append(status, MigrationStatus{m, applied[m.Version]})
+	}
+	return status, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"github.com/PuerkitoBio/goquery"
+	"regexp"
+	"strconv"
+)
+
+// MatchLength is the number of minutes of a match, and ExtraTimeLength of one that went to extra time. Stoppage
+// time is not counted: a substitution in "45+2'" or "90+3'" happens in minute 45 or 90, just as the events of the
+// stoppage time are timed in minute 45 or 90.
+const (
+	MatchLength     = 90
+	ExtraTimeLength = 120
+)
+
+var minuteRe = regexp.MustCompile(`(\d+)\s*(?:\+\s*\d+)?\s*['’]`)
+
+// ParseMinute reads the first minute such as "68'", "90+2'" or "105'" from text, ok is false if there is none.
+func ParseMinute(text string) (minute int, ok bool) {
+	res := minuteRe.FindStringSubmatch(text)
+	if res == nil {
+		return 0, false
+	}
+	minute, _ = strconv.Atoi(res[1])
+	return minute, true
+}
+
+// matchLength is the length of a match whose last substitution or red card was in minute last: ExtraTimeLength
+// if that is past MatchLength.
+func matchLength(last int) int {
+	if last > MatchLength {
+		return ExtraTimeLength
+	}
+	return MatchLength
+}
+
+// substitution is a player coming on for another one, identified by the urls of their player stats pages.
+type substitution struct {
+	onUrl, offUrl string
+	minute        int
+}
+
+// parseSubstitution reads a substitution from an entry of the substitutes list: the player coming on is the first
+// link, the player going off any other link to a player stats page, and the minute is given in the entry's text.
+func parseSubstitution(s *goquery.Selection) (sub substitution, ok bool) {
+	onUrl, exists := s.Find("div ul .first a").Attr("href")
+	if !exists {
+		return sub, false
+	}
+	minute, hasMinute := ParseMinute(s.Text())
+	if !hasMinute {
+		return sub, false
+	}
+	sub = substitution{onUrl: PREFIX + onUrl, minute: minute}
+	s.Find("div ul a").Each(func(i int, a *goquery.Selection) {
+		if href, _ := a.Attr("href"); href != onUrl && GetIdFromPlayerStatsUrl(href) != "" {
+			sub.offUrl = PREFIX + href
+		}
+	})
+	return sub, true
+}
+
+// parseRedCard reads the minute of a red card shown next to a player, ok is false if there is none.
+func parseRedCard(s *goquery.Selection) (minute int, ok bool) {
+	card := s.Find(`.red, .red-card, .redcard, .card-red, [class*="red-card"], [class*="redcard"]`).First()
+	if card.Length() == 0 {
+		return 0, false
+	}
+	title, _ := card.Attr("title")
+	if minute, ok := ParseMinute(card.Text() + " " + title); ok {
+		return minute, true
+	}
+	return ParseMinute(s.Text())
+}
+
+// setMinutes fills in when the players of a match came on and went off, and how long they played. Starters come on
+// in minute 0, and everybody who is not substituted or sent off plays until the end of the match. The minutes of
+// substitutes whose substitution could not be parsed are left nil, as they are unknown.
+func setMinutes(playerStatsArray []PlayerStats, subs []substitution, redCards map[string]int) {
+	last := 0
+	for _, sub := range subs {
+		if sub.minute > last {
+			last = sub.minute
+		}
+	}
+	for _, minute := range redCards {
+		if minute > last {
+			last = minute
+		}
+	}
+	length := matchLength(last)
+
+	byUrl := make(map[string]*PlayerStats)
+	for i, _ := range playerStatsArray {
+		ps := &playerStatsArray[i]
+		byUrl[ps.Url] = ps
+		if !ps.IsSubstitute {
+			on, off := 0, length
+			ps.MinuteOn, ps.MinuteOff = &on, &off
+		}
+	}
+
+	for _, sub := range subs {
+		if ps, ok := byUrl[sub.onUrl]; ok {
+			on, off := sub.minute, length
+			ps.MinuteOn, ps.MinuteOff = &on, &off
+		}
+	}
+	for _, sub := range subs {
+		if ps, ok := byUrl[sub.offUrl]; ok && ps.MinuteOff != nil {
+			*ps.MinuteOff = sub.minute
+		}
+	}
+	for url, minute := range redCards {
+		if ps, ok := byUrl[url]; ok && (ps.MinuteOff == nil || minute <= *ps.MinuteOff) {
+			if ps.MinuteOff != nil {
+				*ps.MinuteOff = minute
+			}
+			ps.SentOff = true
+		}
+	}
+
+	for _, ps := range byUrl {
+		if ps.MinuteOn == nil {
+			continue
+		}
+		played := *ps.MinuteOff - *ps.MinuteOn
+		if played < 0 {
+			played = 0
+		}
+		ps.MinutesPlayed = &played
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"github.com/PuerkitoBio/goquery"
+	"strings"
+	"testing"
+)
+
+// matchPage is a match page in the markup ParsePlayerStatsOfMatch reads: a .lineup entry per starter, with the
+// red card icon shown next to the name, and the substitutes listed as the player coming on followed by the player
+// going off and the minute.
+const matchPage = `<html><body>
+<div class="lineup home"><span><a href="/statszone/8-2016/matches/1/player-stats/11/OVERALL_02">Home Keeper</a></span></div>
+<div class="lineup home"><span><a href="/statszone/8-2016/matches/1/player-stats/12/OVERALL_02">Home Striker</a></span></div>
+<div class="lineup home"><span><a href="/statszone/8-2016/matches/1/player-stats/13/OVERALL_02">Home Defender</a><span class="red" title="Sent off 38'"></span></span></div>
+<div class="lineup away"><span><a href="/statszone/8-2016/matches/1/player-stats/21/OVERALL_02">Away Keeper</a></span></div>
+<div class="lineup away"><span><a href="/statszone/8-2016/matches/1/player-stats/22/OVERALL_02">Away Striker</a><img class="card-red" alt="">  <span>109'</span></span></div>
+<div id="substitutes">
+<div class="home subs"><ul>
+<li><div><ul><li class="first"><a href="/statszone/8-2016/matches/1/player-stats/14/OVERALL_02">Home Sub</a></li><li class="other"><a href="/statszone/8-2016/matches/1/player-stats/12/OVERALL_02">Home Striker</a> 105+1'</li></ul></div></li>
+<li><div><ul><li class="first"><a href="/statszone/8-2016/matches/1/player-stats/15/OVERALL_02">Home Unknown Sub</a></li><li class="other">on the bench</li></ul></div></li>
+</ul></div>
+<div class="away subs"><ul>
+<li><div><ul><li class="other">unused</li></ul></div></li>
+</ul></div>
+</div>
+</body></html>`
+
+func TestParsePlayerStatsOfMatchMinutes(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(matchPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Match{Id: "1", HomeTeamName: "Home", AwayTeamName: "Away"}
+
+	want := map[string]struct {
+		on, off, played int
+		sentOff         bool
+	}{
+		"11": {0, 120, 120, false},
+		"12": {0, 105, 105, false},
+		"13": {0, 38, 38, true},
+		"21": {0, 120, 120, false},
+		"22": {0, 109, 109, true},
+		"14": {105, 120, 15, false}}
+	playerStatsArray := ParsePlayerStatsOfMatch(doc, m)
+	if len(playerStatsArray) != 7 {
+		t.Fatalf("%d players, want 7", len(playerStatsArray))
+	}
+	for _, ps := range playerStatsArray {
+		if ps.PlayerId == "15" {
+			if ps.MinuteOn != nil || ps.MinuteOff != nil || ps.MinutesPlayed != nil {
+				t.Errorf("substitute without substitution has minutes %v-%v", ps.MinuteOn, ps.MinuteOff)
+			}
+			continue
+		}
+		w, ok := want[ps.PlayerId]
+		if !ok {
+			t.Errorf("unexpected player %s", ps.PlayerId)
+			continue
+		}
+		if ps.MinuteOn == nil || ps.MinuteOff == nil || ps.MinutesPlayed == nil {
+			t.Errorf("player %s has no minutes", ps.PlayerId)
+			continue
+		}
+		if *ps.MinuteOn != w.on || *ps.MinuteOff != w.off || *ps.MinutesPlayed != w.played || ps.SentOff != w.sentOff {
+			t.Errorf("player %s played %d-%d (%d), sent off %v, want %d-%d (%d), %v", ps.PlayerId, *ps.MinuteOn,
+				*ps.MinuteOff, *ps.MinutesPlayed, ps.SentOff, w.on, w.off, w.played, w.sentOff)
+		}
+	}
+}
+
+func TestSetMinutesRegularTime(t *testing.T) {
+	playerStatsArray := []PlayerStats{
+		{Url: "starter"},
+		{Url: "replaced"},
+		{Url: "sub", IsSubstitute: true}}
+	setMinutes(playerStatsArray, []substitution{{onUrl: "sub", offUrl: "replaced", minute: 90}}, nil)
+
+	for i, want := range []int{90, 90, 0} {
+		if played := playerStatsArray[i].MinutesPlayed; played == nil || *played != want {
+			t.Errorf("%s played %v, want %d", playerStatsArray[i].Url, played, want)
+		}
+	}
+}
+
+func TestParseMinute(t *testing.T) {
+	for text, want := range map[string]int{"68'": 68, "90+2'": 90, "Booked 45 + 1’": 45, "105'": 105, "118+3'": 118} {
+		if minute, ok := ParseMinute(text); !ok || minute != want {
+			t.Errorf("ParseMinute(%q) = %d, %v, want %d", text, minute, ok, want)
+		}
+	}
+	if _, ok := ParseMinute("on the bench"); ok {
+		t.Error("ParseMinute found a minute in text without one")
+	}
+}
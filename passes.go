@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"fourfourtwo/pitch"
+	"github.com/jmoiron/sqlx"
+	"image/color"
+	"math"
+)
+
+// Pass map colours of the pass event types, by outcome.
+var passColors = map[string]color.Color{
+	"pass_success":        color.RGBA{0x1f, 0x77, 0xb4, 0xff},
+	"pass_fail":           color.RGBA{0xd6, 0x27, 0x28, 0xff},
+	"pass_chance_created": color.RGBA{0x2c, 0xa0, 0x2c, 0xff},
+	"pass_goal_assist":    color.RGBA{0xff, 0x7f, 0x0e, 0xff},
+}
+
+// Final third of the pitch, and how much closer to the goal a pass has to move the ball to be progressive.
+const (
+	finalThirdX      = PitchLength * 2 / 3
+	progressiveShare = 0.25
+)
+
+// PassFilter selects the passes of a player in a season, or in one match only, optionally of one half and of
+// a range of minutes.
+type PassFilter struct {
+	PlayerId  string
+	Season    int
+	MatchId   string
+	Half      int // 0 is both halves
+	MinMinute int
+	MaxMinute int // 0 is no upper bound
+}
+
+// Pass is a pass in pitch coordinates.
+type Pass struct {
+	EventType   string  `db:"event_type"`
+	Outcome     string  `db:"outcome"`
+	EventHalf   int     `db:"event_half"`
+	EventMinute int     `db:"event_minute"`
+	X1          float64 `db:"pitch_x1"`
+	Y1          float64 `db:"pitch_y1"`
+	X2          float64 `db:"pitch_x2"`
+	Y2          float64 `db:"pitch_y2"`
+}
+
+// GetPasses lists the passes selected by filter in the order they were played.
+func GetPasses(db *sqlx.DB, filter PassFilter) ([]Pass, error) {
+	maxMinute := filter.MaxMinute
+	if maxMinute == 0 {
+		maxMinute = math.MaxInt32
+	}
+	passes := []Pass{}
+	q := `SELECT e.event_type, coalesce(e.outcome, '') AS outcome, e.event_half, e.event_minute,
+				e.pitch_x1, e.pitch_y1, e.pitch_x2, e.pitch_y2
+			FROM player_event e
+				JOIN player_stats ps ON ps.id = e.player_stats_id
+				JOIN match m ON m.id = ps.match_id
+			WHERE ps.player_id = $1 AND m.season = $2 AND ($3 = '' OR m.id = $3) AND ($4 = 0 OR e.event_half = $4)
+				AND e.event_minute BETWEEN $5 AND $6 AND e.category = $7 AND e.pitch_x1 IS NOT NULL
+			ORDER BY m.match_date, e.event_half, e.event_minute, e.id`
+	err := db.Select(&passes, q, filter.PlayerId, filter.Season, filter.MatchId, filter.Half,
+		filter.MinMinute, maxMinute, string(CategoryPass))
+	return passes, err
+}
+
+// Length is the distance the pass moved the ball, in metres.
+func (p Pass) Length() float64 {
+	return math.Hypot(p.X2-p.X1, p.Y2-p.Y1)
+}
+
+func distanceToGoal(x, y float64) float64 {
+	return math.Hypot(PitchLength-x, PitchWidth/2-y)
+}
+
+// IsProgressive tells whether the pass moved the ball at least a quarter closer to the centre of the goal
+// attacked.
+func (p Pass) IsProgressive() bool {
+	return distanceToGoal(p.X2, p.Y2) <= (1-progressiveShare)*distanceToGoal(p.X1, p.Y1)
+}
+
+// IsIntoFinalThird tells whether the pass was played from outside the final third into it.
+func (p Pass) IsIntoFinalThird() bool {
+	return p.X1 < finalThirdX && p.X2 >= finalThirdX
+}
+
+// PassStats summarizes a set of passes.
+type PassStats struct {
+	Passes         int
+	Completed      int
+	AverageLength  float64
+	Progressive    int
+	IntoFinalThird int
+	ChancesCreated int
+	Assists        int
+}
+
+// ComputePassStats summarizes passes from their end points and types.
+func ComputePassStats(passes []Pass) PassStats {
+	stats := PassStats{Passes: len(passes)}
+	var length float64
+	for _, p := range passes {
+		length += p.Length()
+		if p.Outcome == string(OutcomeSuccess) {
+			stats.Completed++
+		}
+		if p.IsProgressive() {
+			stats.Progressive++
+		}
+		if p.IsIntoFinalThird() {
+			stats.IntoFinalThird++
+		}
+		switch p.EventType {
+		case "pass_chance_created":
+			stats.ChancesCreated++
+		case "pass_goal_assist":
+			stats.Assists++
+		}
+	}
+	if len(passes) > 0 {
+		stats.AverageLength = length / float64(len(passes))
+	}
+	return stats
+}
+
+// Lines returns the statistics as lines of text.
+func (s PassStats) Lines() []string {
+	completion := 0.0
+	if s.Passes > 0 {
+		completion = 100 * float64(s.Completed) / float64(s.Passes)
+	}
+	return []string{
+		fmt.Sprintf("passes: %d, completed: %d (%.0f%%), average length: %.1f m", s.Passes, s.Completed, completion, s.AverageLength),
+		fmt.Sprintf("progressive: %d, into the final third: %d", s.Progressive, s.IntoFinalThird),
+		fmt.Sprintf("chances created: %d, assists: %d", s.ChancesCreated, s.Assists)}
+}
+
+// RenderPassMap draws the passes selected by filter as arrows coloured by outcome, with their statistics below,
+// and writes the image to path. It returns the statistics.
+func RenderPassMap(db *sqlx.DB, filter PassFilter, path, format string) (PassStats, error) {
+	passes, err := GetPasses(db, filter)
+	if err != nil {
+		return PassStats{}, err
+	}
+	stats := ComputePassStats(passes)
+
+	subject := "player " + filter.PlayerId
+	if p, err := GetPlayer(db, filter.PlayerId); err == nil {
+		subject = p.Name
+	}
+	title := fmt.Sprintf("%s, %d-%d: passes", subject, filter.Season, filter.Season+1)
+	if filter.MatchId != "" {
+		title += ", match " + filter.MatchId
+	}
+	if filter.Half != 0 {
+		title += fmt.Sprintf(", half %d", filter.Half)
+	}
+	if filter.MinMinute != 0 || filter.MaxMinute != 0 {
+		title += fmt.Sprintf(", minutes %d-%d", filter.MinMinute, filter.MaxMinute)
+	}
+
+	arrows := make([]pitch.Arrow, len(passes))
+	for i, p := range passes {
+		arrows[i] = pitch.Arrow{From: pitch.Point{X: p.X1, Y: p.Y1}, To: pitch.Point{X: p.X2, Y: p.Y2}, Label: p.EventType}
+	}
+	passMap := pitch.NewPassMap(title, arrows, stats.Lines())
+	for eventType, c := range passColors {
+		passMap.Colors[eventType] = c
+	}
+	return stats, writeImage(path, format, passMap)
+}
+
+// ParseMinutes reads a range of minutes given as "<from>-<to>", e.g. "60-90", or "" for the whole match.
+func ParseMinutes(s string) (from, to int, err error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	if n, err := fmt.Sscanf(s, "%d-%d", &from, &to); err != nil || n != 2 || from < 0 || to < from {
+		return 0, 0, fmt.Errorf("bad minutes %q, expected e.g. 60-90", s)
+	}
+	return from, to, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestIsProgressive(t *testing.T) {
+	goalY := PitchWidth / 2
+	for _, c := range []struct {
+		name           string
+		x1, y1, x2, y2 float64
+		progressive    bool
+	}{
+		{"exactly a quarter closer", 65, goalY, 75, goalY, true},
+		{"just short of a quarter", 65, goalY, 74.9, goalY, false},
+		{"backwards", 60, goalY, 50, goalY, false},
+		{"sideways", 80, 10, 80, 58, false},
+		{"diagonal towards the goal", 70, 10, 95, 30, true},
+		{"into the goal mouth", 100, goalY, PitchLength, goalY, true},
+	} {
+		p := Pass{X1: c.x1, Y1: c.y1, X2: c.x2, Y2: c.y2}
+		if got := p.IsProgressive(); got != c.progressive {
+			t.Errorf("%s: IsProgressive of %+v = %v, want %v", c.name, p, got, c.progressive)
+		}
+	}
+}
+
+func TestIsIntoFinalThird(t *testing.T) {
+	for _, c := range []struct {
+		x1, x2 float64
+		into   bool
+	}{
+		{60, 70, true},
+		{60, finalThirdX, true},
+		{finalThirdX, 90, false},
+		{50, 60, false},
+		{90, 60, false},
+	} {
+		if got := (Pass{X1: c.x1, X2: c.x2}).IsIntoFinalThird(); got != c.into {
+			t.Errorf("IsIntoFinalThird from %v to %v = %v, want %v", c.x1, c.x2, got, c.into)
+		}
+	}
+}
+
+func TestComputePassStats(t *testing.T) {
+	if s := ComputePassStats(nil); s != (PassStats{}) {
+		t.Errorf("ComputePassStats(nil) = %+v, want zeros", s)
+	}
+
+	y := PitchWidth / 2
+	passes := []Pass{
+		{EventType: "pass_success", Outcome: string(OutcomeSuccess), X1: 30, Y1: y, X2: 40, Y2: y},
+		{EventType: "pass_fail", Outcome: string(OutcomeFail), X1: 60, Y1: y, X2: 80, Y2: y},
+		{EventType: "pass_chance_created", Outcome: string(OutcomeSuccess), X1: 80, Y1: 30, X2: 80, Y2: 10},
+		{EventType: "pass_goal_assist", Outcome: string(OutcomeSuccess), X1: 90, Y1: 20, X2: 100, Y2: y},
+	}
+	s := ComputePassStats(passes)
+	want := PassStats{Passes: 4, Completed: 3, Progressive: 2, IntoFinalThird: 1, ChancesCreated: 1, Assists: 1}
+	length := s.AverageLength
+	s.AverageLength = 0
+	if s != want {
+		t.Errorf("ComputePassStats = %+v, want %+v", s, want)
+	}
+	if wantLength := (10 + 20 + 20 + math.Hypot(10, 14)) / 4; math.Abs(length-wantLength) > 1e-9 {
+		t.Errorf("AverageLength = %v, want %v", length, wantLength)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// PipelineOptions sets the number of workers of each stage of the pipeline, and whether matches crawled completely
+// before are crawled again.
+type PipelineOptions struct {
+	DiscoverWorkers int
+	LineupWorkers   int
+	EventWorkers    int
+	PersistWorkers  int
+	Force           bool
+}
+
+// MatchJob carries a match through the pipeline together with its players and the count of those not done yet.
+type MatchJob struct {
+	Match   *Match
+	Players []PlayerJob
+	pending int32
+}
+
+// PlayerJob is one player stats page of a match. The crawled events and the error, if any, travel with the job,
+// so every result is saved under the player it was crawled for.
+type PlayerJob struct {
+	MatchJob    *MatchJob
+	PlayerStats *PlayerStats
+	Err         error
+}
+
+// Pipeline crawls matches in four stages, each backed by its own pool of workers:
+//
+//	discover  skip matches that are already crawled completely, unless forced, and save the others as listed
+//	lineups   list the players of a match page
+//	events    fetch the events of every player stats page
+//	persist   once the last player of a match is done, save the whole match in one transaction
+//
+// Failed pages are recorded in the crawl_failure table and do not stop the pipeline. Cancelling ctx stops all
+// stages; matches that were in flight are not saved at all.
+type Pipeline struct {
+	ctx   context.Context
+	store Store
+	f     Fetcher
+	opts  PipelineOptions
+
+	matches  chan *Match
+	lineups  chan *MatchJob
+	players  chan *PlayerJob
+	persists chan *PlayerJob
+	done     chan bool
+
+	crawled, skipped int32
+}
+
+func NewPipeline(ctx context.Context, store Store, f Fetcher, opts PipelineOptions) *Pipeline {
+	return &Pipeline{
+		ctx:      ctx,
+		store:    store,
+		f:        f,
+		opts:     opts,
+		matches:  make(chan *Match),
+		lineups:  make(chan *MatchJob, opts.LineupWorkers),
+		players:  make(chan *PlayerJob, opts.EventWorkers),
+		persists: make(chan *PlayerJob, opts.PersistWorkers),
+		done:     make(chan bool)}
+}
+
+// Start feeds matches into the pipeline and starts the workers of all stages.
+func (p *Pipeline) Start(matches []Match) {
+	runStage(p.opts.DiscoverWorkers, p.discover, func() { close(p.lineups) })
+	runStage(p.opts.LineupWorkers, p.crawlLineups, func() { close(p.players) })
+	runStage(p.opts.EventWorkers, p.crawlEvents, func() { close(p.persists) })
+	runStage(p.opts.PersistWorkers, p.persist, func() { close(p.done) })
+
+	go func() {
+		defer close(p.matches)
+		for i, _ := range matches {
+			select {
+			case p.matches <- &matches[i]:
+			case <-p.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Wait blocks until all matches went through the pipeline, or the pipeline was cancelled.
+func (p *Pipeline) Wait() error {
+	<-p.done
+	return p.ctx.Err()
+}
+
+// Crawled is the number of matches saved, and Skipped the number of those not crawled again.
+func (p *Pipeline) Crawled() int {
+	return int(atomic.LoadInt32(&p.crawled))
+}
+
+func (p *Pipeline) Skipped() int {
+	return int(atomic.LoadInt32(&p.skipped))
+}
+
+// runStage starts n workers and calls after once all of them have returned.
+func runStage(n int, worker func(), after func()) {
+	if n < 1 {
+		n = 1
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker()
+		}()
+	}
+	go func() {
+		wg.Wait()
+		after()
+	}()
+}
+
+func (p *Pipeline) discover() {
+	for m := range p.matches {
+		if !p.opts.Force {
+			crawled, err := p.store.IsMatchCrawled(m)
+			if err != nil {
+				p.store.RecordFailure(m.Url, StageMatch, m.Id, err)
+				continue
+			}
+			if crawled {
+				atomic.AddInt32(&p.skipped, 1)
+				continue
+			}
+		}
+		if err := p.store.SaveListedMatch(m); err != nil {
+			p.store.RecordFailure(m.Url, StageMatch, m.Id, err)
+			continue
+		}
+
+		select {
+		case p.lineups <- &MatchJob{Match: m}:
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *Pipeline) crawlLineups() {
+	for job := range p.lineups {
+		if p.ctx.Err() != nil {
+			return
+		}
+		playerStatsArray, err := p.crawlLineup(job.Match)
+		if err != nil {
+			p.store.RecordFailure(job.Match.Url, StageMatch, job.Match.Id, err)
+			continue
+		}
+		p.store.ResolveFailure(job.Match.Url, StageMatch)
+
+		if len(playerStatsArray) == 0 {
+			p.saveMatch(job)
+			continue
+		}
+		job.Players = make([]PlayerJob, len(playerStatsArray))
+		job.pending = int32(len(playerStatsArray))
+		for i, _ := range playerStatsArray {
+			job.Players[i] = PlayerJob{MatchJob: job, PlayerStats: &playerStatsArray[i]}
+		}
+		for i, _ := range job.Players {
+			select {
+			case p.players <- &job.Players[i]:
+			case <-p.ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// crawlLineup lists the starting squad and the substitutes of a match.
+func (p *Pipeline) crawlLineup(m *Match) ([]PlayerStats, error) {
+	fmt.Printf("[%s] %s\n", m.Id, m.Url)
+	doc, err := FetchDocument(p.ctx, p.f, m.Url)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePlayerStatsOfMatch(doc, m), nil
+}
+
+func (p *Pipeline) crawlEvents() {
+	for job := range p.players {
+		if p.ctx.Err() != nil {
+			return
+		}
+		fmt.Printf("[%s] %s\n", job.PlayerStats.PlayerId, job.PlayerStats.Url)
+		job.Err = CrawlPlayerRawEvents(p.ctx, p.f, job.PlayerStats)
+
+		select {
+		case p.persists <- job:
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *Pipeline) persist() {
+	for job := range p.persists {
+		if p.ctx.Err() != nil {
+			return
+		}
+		ps := job.PlayerStats
+		if job.Err != nil {
+			p.store.RecordFailure(ps.Url, StagePlayerStats, ps.MatchId, job.Err)
+		} else {
+			p.store.ResolveFailure(ps.Url, StagePlayerStats)
+		}
+
+		if atomic.AddInt32(&job.MatchJob.pending, -1) == 0 {
+			p.saveMatch(job.MatchJob)
+		}
+	}
+}
+
+// saveMatch saves a match with all players crawled successfully. Players that failed are in the crawl_failure
+// table and keep the match flagged as not crawled until they are retried.
+func (p *Pipeline) saveMatch(job *MatchJob) {
+	playerStatsArray := make([]*PlayerStats, 0, len(job.Players))
+	for i, _ := range job.Players {
+		if job.Players[i].Err == nil {
+			playerStatsArray = append(playerStatsArray, job.Players[i].PlayerStats)
+		}
+	}
+	complete := len(playerStatsArray) == len(job.Players)
+
+	if err := p.store.SaveMatch(job.Match, playerStatsArray, complete); err != nil {
+		p.store.RecordFailure(job.Match.Url, StageMatch, job.Match.Id, err)
+		return
+	}
+	atomic.AddInt32(&p.crawled, 1)
+}
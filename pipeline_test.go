@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeFetcher serves pages from memory, keyed by url without the fragment. Every fetch takes a millisecond, so
+// the stages of a pipeline overlap as they do on a real crawl.
+type fakeFetcher map[string]string
+
+func (f fakeFetcher) Fetch(ctx context.Context, url string) ([]byte, error) {
+	time.Sleep(time.Millisecond)
+	page, ok := f[StripFragment(url)]
+	if !ok {
+		return nil, fmt.Errorf("%s: 404 Not Found", url)
+	}
+	return []byte(page), nil
+}
+
+// addMatch serves the match page of m and the player stats pages of its 22 starters.
+func (f fakeFetcher) addMatch(m Match) {
+	var lineups strings.Builder
+	for i := 0; i < 22; i++ {
+		side := "home"
+		if i >= 11 {
+			side = "away"
+		}
+		playerId := fmt.Sprintf("%s%02d", m.Id, i)
+		path := fmt.Sprintf("/statszone/8-2016/matches/%s/player-stats/%s/OVERALL_02", m.Id, playerId)
+		fmt.Fprintf(&lineups, `<div class="lineup %s"><span><a href="%s">Player %s</a></span></div>`, side, path, playerId)
+		f[PREFIX+path] = fmt.Sprintf(`<html><body><div id="statzone_player_header"><h1>Player %s</h1></div><svg>
+<line class="pitch-object timer-1-12" marker-end="url(#smallblue)" x1="100" y1="200" x2="300" y2="250"></line>
+<line class="pitch-object timer-2-70" marker-end="url(#bigblue)" x1="580" y1="200" x2="680" y2="262"></line>
+</svg></body></html>`, playerId)
+	}
+	f[StripFragment(m.Url)] = fmt.Sprintf(`<html><body>%s<div id="substitutes"></div></body></html>`, lineups.String())
+}
+
+func TestPipelineConcurrentSaves(t *testing.T) {
+	store := newTestStore(t)
+	f := make(fakeFetcher)
+	matches := make([]Match, 40)
+	for i, _ := range matches {
+		m, _ := testMatch(fmt.Sprintf("9%05d", i), fmt.Sprintf("Home %d", i), fmt.Sprintf("Away %d", i), 11)
+		m.Url += "#tabs-wrapper-anchor"
+		matches[i] = *m
+		f.addMatch(*m)
+	}
+	// some pages fail, so failures are recorded while other matches are saved
+	delete(f, StripFragment(matches[5].Url))
+	delete(f, PREFIX+fmt.Sprintf("/statszone/8-2016/matches/%s/player-stats/%s03/OVERALL_02", matches[9].Id, matches[9].Id))
+
+	// the pipeline only logs the failures it cannot record, such as "database table is locked"
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	p := NewPipeline(context.Background(), store, f, PipelineOptions{DiscoverWorkers: 1, LineupWorkers: 3, EventWorkers: 10, PersistWorkers: 1})
+	p.Start(matches)
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	if logged.Len() > 0 {
+		t.Errorf("pipeline logged errors:\n%s", logged.String())
+	}
+
+	db := store.DB()
+	for i, _ := range matches {
+		m := &matches[i]
+		crawled, err := store.IsMatchCrawled(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var failures int
+		if err := db.Get(&failures, `SELECT count(*) FROM crawl_failure WHERE match_id = $1`, m.Id); err != nil {
+			t.Fatal(err)
+		}
+		if !crawled && failures == 0 {
+			t.Errorf("match %s is neither crawled nor in crawl_failure", m.Id)
+		}
+		if crawled != (i != 5 && i != 9) {
+			t.Errorf("match %s crawled = %v", m.Id, crawled)
+		}
+	}
+
+	var playerStats, events int
+	if err := db.Get(&playerStats, `SELECT count(*) FROM player_stats`); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Get(&events, `SELECT count(*) FROM player_event`); err != nil {
+		t.Fatal(err)
+	}
+	if playerStats != 39*22-1 || events != 2*playerStats {
+		t.Errorf("%d player stats with %d events, want %d with 2 each", playerStats, events, 39*22-1)
+	}
+}
+
+func TestRetryFailedLineupKeepsListing(t *testing.T) {
+	store := newTestStore(t)
+	f := make(fakeFetcher)
+	m, _ := testMatch("900100", "Arsenal", "Liverpool", 11)
+	f.addMatch(*m)
+	page := f[m.Url]
+	delete(f, m.Url)
+
+	p := NewPipeline(context.Background(), store, f, PipelineOptions{DiscoverWorkers: 1, LineupWorkers: 1, EventWorkers: 1, PersistWorkers: 1})
+	p.Start([]Match{*m})
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	f[m.Url] = page
+	failures, err := store.ListFailures(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 1 || failures[0].Stage != StageMatch {
+		t.Fatalf("failures %+v, want the match page", failures)
+	}
+	matches := RetryFailures(context.Background(), store, f, failures)
+	p = NewPipeline(context.Background(), store, f, PipelineOptions{DiscoverWorkers: 1, LineupWorkers: 1, EventWorkers: 1, PersistWorkers: 1})
+	p.Start(matches)
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := store.GetMatch(m.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !saved.IsCrawled || saved.MatchDate == nil || !saved.MatchDate.Equal(*m.MatchDate) ||
+		saved.HomeTeamName != "Arsenal" || saved.AwayTeamName != "Liverpool" || saved.HomeScore != 2 || saved.AwayScore != 1 {
+		t.Errorf("match retried after its page failed saved as %+v", saved)
+	}
+}
+
+func TestPipelineForceCrawlsAgain(t *testing.T) {
+	store := newTestStore(t)
+	f := make(fakeFetcher)
+	m, _ := testMatch("900200", "Arsenal", "Liverpool", 11)
+	f.addMatch(*m)
+
+	for i, c := range []struct {
+		force            bool
+		crawled, skipped int
+	}{{false, 1, 0}, {false, 0, 1}, {true, 1, 0}} {
+		opts := PipelineOptions{DiscoverWorkers: 1, LineupWorkers: 1, EventWorkers: 1, PersistWorkers: 1, Force: c.force}
+		p := NewPipeline(context.Background(), store, f, opts)
+		p.Start([]Match{*m})
+		if err := p.Wait(); err != nil {
+			t.Fatal(err)
+		}
+		if p.Crawled() != c.crawled || p.Skipped() != c.skipped {
+			t.Errorf("crawl %d (force %v): %d crawled and %d skipped, want %d and %d", i+1, c.force, p.Crawled(),
+				p.Skipped(), c.crawled, c.skipped)
+		}
+	}
+}
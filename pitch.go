@@ -0,0 +1,261 @@
+package main
+
+import (
+	"github.com/jmoiron/sqlx"
+	"sort"
+)
+
+// Dimensions in metres of the pitch all normalized coordinates are given on. The origin is the bottom left corner
+// and the team the event belongs to attacks from left to right.
+const (
+	PitchLength = 105.0
+	PitchWidth  = 68.0
+)
+
+// Touch lines and goal lines of the pitch in the raw D3 frame of the statszone pages, where y grows downwards.
+const (
+	rawPitchLeft   = 51.0
+	rawPitchTop    = 51.0
+	rawPitchRight  = 689.0
+	rawPitchBottom = 479.0
+)
+
+// ToPitch converts a point of the raw D3 frame into metres on the standard pitch.
+func ToPitch(p Point) Point {
+	return Point{
+		x: (p.x - rawPitchLeft) / (rawPitchRight - rawPitchLeft) * PitchLength,
+		y: (rawPitchBottom - p.y) / (rawPitchBottom - rawPitchTop) * PitchWidth}
+}
+
+// Mirror turns a point of the standard pitch around its centre spot, swapping the direction of play.
+func (p Point) Mirror() Point {
+	return Point{PitchLength - p.x, PitchWidth - p.y}
+}
+
+// NormalizeEvent fills in the pitch coordinates of e from its raw ones. attackingRight is the direction the team
+// of the player played in during the half of the event.
+func NormalizeEvent(e *PlayerEvent, attackingRight bool) {
+	e.PitchStart, e.PitchEnd = ToPitch(e.StartPoint), ToPitch(e.EndPoint)
+	if !attackingRight {
+		e.PitchStart, e.PitchEnd = e.PitchStart.Mirror(), e.PitchEnd.Mirror()
+	}
+}
+
+// IsAttackingRight guesses the direction a team played in from its events of one half: attacking actions (shots,
+// chances created, take ons) happen further up the pitch than defensive ones. Without both kinds of events it falls
+// back to whether successful passes went mostly to the right. With no evidence at all the team attacks right.
+func IsAttackingRight(events []PlayerEvent) bool {
+	return attackingEvidence(events) >= 0
+}
+
+// attackingEvidence is how far, in metres, the events of a team in one half say it attacked right: the distance
+// between its attacking and its defensive actions, or else the average length of its successful passes along the
+// pitch. It is negative if the team attacked left, and 0 without evidence either way.
+func attackingEvidence(events []PlayerEvent) float64 {
+	var attackSum, defenceSum, passSum float64
+	var attacks, defences, passes int
+	for _, e := range events {
+		x := ToPitch(e.StartPoint).x
+		e.Classify()
+		switch {
+		case e.Category == CategoryShot, e.Category == CategoryTakeOn,
+			e.HasQualifier(QualifierAssist), e.HasQualifier(QualifierChanceCreated):
+			attackSum += x
+			attacks++
+		case e.Category == CategoryDefensive:
+			defenceSum += x
+			defences++
+		case e.Category == CategoryPass && e.Outcome == OutcomeSuccess:
+			passSum += ToPitch(e.EndPoint).x - x
+			passes++
+		}
+	}
+
+	if attacks > 0 && defences > 0 {
+		return attackSum/float64(attacks) - defenceSum/float64(defences)
+	}
+	if passes > 0 {
+		return passSum / float64(passes)
+	}
+	return 0
+}
+
+// playDirectionKey identifies the events of one team in one half of a match.
+type playDirectionKey struct {
+	team string
+	half int
+}
+
+// PlayDirections works out the direction of play of every team in every half from the events of all players of
+// a match, true meaning the team attacked right. The two teams play in opposite directions and change ends at
+// half-time, and again between the halves of extra time, so the evidence of both teams in both halves of a period
+// is weighed together: a team whose events are ambiguous plays the other way of its opponent, or of itself in the
+// other half.
+func PlayDirections(playerStatsArray []*PlayerStats) map[playDirectionKey]bool {
+	grouped := make(map[playDirectionKey][]PlayerEvent)
+	teams := make([]string, 0, 2)
+	for _, ps := range playerStatsArray {
+		for _, e := range *ps.Events {
+			key := playDirectionKey{ps.TeamName, e.EventHalf}
+			if !containsString(teams, ps.TeamName) {
+				teams = append(teams, ps.TeamName)
+			}
+			grouped[key] = append(grouped[key], e)
+		}
+	}
+	sort.Strings(teams)
+
+	evidence := make(map[playDirectionKey]float64)
+	periods := make(map[int]bool)
+	for key, events := range grouped {
+		evidence[key] = attackingEvidence(events)
+		periods[(key.half+1)/2] = true
+	}
+
+	directions := make(map[playDirectionKey]bool)
+	for period, _ := range periods {
+		first, second := 2*period-1, 2*period
+		// evidence that the first team attacked right in the first half of the period
+		var sum float64
+		for i, team := range teams {
+			sign := 1.0
+			if i > 0 {
+				sign = -1
+			}
+			sum += sign * (evidence[playDirectionKey{team, first}] - evidence[playDirectionKey{team, second}])
+		}
+		for i, team := range teams {
+			right := (sum >= 0) == (i == 0)
+			directions[playDirectionKey{team, first}] = right
+			directions[playDirectionKey{team, second}] = !right
+		}
+	}
+	return directions
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizePlayerStats fills in the pitch coordinates of all events of ps given the directions of play.
+func NormalizePlayerStats(ps *PlayerStats, directions map[playDirectionKey]bool) {
+	events := *ps.Events
+	for i, _ := range events {
+		NormalizeEvent(&events[i], directions[playDirectionKey{ps.TeamName, events[i].EventHalf}])
+	}
+}
+
+// savePlayDirections stores the direction of play of the teams of a match, so that players crawled again later
+// are normalized the same way as their team mates.
+func savePlayDirections(s *Statements, matchId string, playerStatsArray []*PlayerStats, directions map[playDirectionKey]bool) error {
+	teamIds := make(map[string]int64)
+	for _, ps := range playerStatsArray {
+		if ps.TeamId != nil {
+			teamIds[ps.TeamName] = *ps.TeamId
+		}
+	}
+
+	for key, attackingRight := range directions {
+		teamId, ok := teamIds[key.team]
+		if !ok {
+			continue
+		}
+		if _, err := s.Exec("play_direction.upsert", matchId, teamId, key.half, attackingRight); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeRetriedPlayerStats normalizes the events of a single player, using the directions of play stored for the
+// team when the match was saved, or else the player's own events.
+func normalizeRetriedPlayerStats(s *Statements, ps *PlayerStats) error {
+	stored := []struct {
+		Half           int  `db:"event_half"`
+		AttackingRight bool `db:"attacking_right"`
+	}{}
+	if ps.TeamId != nil {
+		if err := s.Select(&stored, "play_direction.by_team", ps.MatchId, *ps.TeamId); err != nil {
+			return err
+		}
+	}
+
+	directions := PlayDirections([]*PlayerStats{ps})
+	for _, d := range stored {
+		directions[playDirectionKey{ps.TeamName, d.Half}] = d.AttackingRight
+	}
+	NormalizePlayerStats(ps, directions)
+	return nil
+}
+
+// backfillPitchCoordinates normalizes the events saved before pitch coordinates were stored.
+func backfillPitchCoordinates(tx *sqlx.Tx) error {
+	rows := []struct {
+		Id        int64   `db:"id"`
+		MatchId   string  `db:"match_id"`
+		TeamId    *int64  `db:"team_id"`
+		TeamName  string  `db:"team_name"`
+		EventHalf int     `db:"event_half"`
+		EventType string  `db:"event_type"`
+		X1        float64 `db:"x1"`
+		Y1        float64 `db:"y1"`
+		X2        float64 `db:"x2"`
+		Y2        float64 `db:"y2"`
+	}{}
+	q := `SELECT e.id, ps.match_id, ps.team_id, ps.team_name, e.event_half, e.event_type, e.x1, e.y1, e.x2, e.y2
+			FROM player_event e JOIN player_stats ps ON ps.id = e.player_stats_id
+			ORDER BY ps.match_id, e.id`
+	if err := tx.Select(&rows, q); err != nil {
+		return err
+	}
+
+	// one PlayerStats per team and match is enough to work out the directions of play
+	teams := make(map[string]map[string]*PlayerStats)
+	for _, r := range rows {
+		if teams[r.MatchId] == nil {
+			teams[r.MatchId] = make(map[string]*PlayerStats)
+		}
+		ps, ok := teams[r.MatchId][r.TeamName]
+		if !ok {
+			events := make([]PlayerEvent, 0)
+			ps = &PlayerStats{MatchId: r.MatchId, TeamId: r.TeamId, TeamName: r.TeamName, Events: &events}
+			teams[r.MatchId][r.TeamName] = ps
+		}
+		*ps.Events = append(*ps.Events, PlayerEvent{
+			EventHalf:  r.EventHalf,
+			EventType:  r.EventType,
+			StartPoint: Point{r.X1, r.Y1},
+			EndPoint:   Point{r.X2, r.Y2}})
+	}
+
+	directions := make(map[string]map[playDirectionKey]bool)
+	s := TxStatements(tx)
+	for matchId, byTeam := range teams {
+		playerStatsArray := make([]*PlayerStats, 0, len(byTeam))
+		for _, ps := range byTeam {
+			playerStatsArray = append(playerStatsArray, ps)
+		}
+		directions[matchId] = PlayDirections(playerStatsArray)
+		if err := savePlayDirections(s, matchId, playerStatsArray, directions[matchId]); err != nil {
+			return err
+		}
+	}
+
+	stmt, err := tx.Preparex(`UPDATE player_event SET pitch_x1 = $1, pitch_y1 = $2, pitch_x2 = $3, pitch_y2 = $4 WHERE id = $5`)
+	if err != nil {
+		return err
+	}
+	for _, r := range rows {
+		e := PlayerEvent{StartPoint: Point{r.X1, r.Y1}, EndPoint: Point{r.X2, r.Y2}}
+		NormalizeEvent(&e, directions[r.MatchId][playDirectionKey{r.TeamName, r.EventHalf}])
+		if _, err := stmt.Exec(e.PitchStart.x, e.PitchStart.y, e.PitchEnd.x, e.PitchEnd.y, r.Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
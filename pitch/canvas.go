@@ -0,0 +1,138 @@
+package pitch
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// SVGCanvas records shapes as SVG elements. WriteTo writes the complete SVG document.
+type SVGCanvas struct {
+	width, height float64
+	body          bytes.Buffer
+}
+
+func NewSVGCanvas(width, height float64) *SVGCanvas {
+	return &SVGCanvas{width: width, height: height}
+}
+
+func svgColor(c color.Color) string {
+	if c == nil {
+		return "none"
+	}
+	r, g, b, a := c.RGBA()
+	if a == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("rgba(%d,%d,%d,%.3f)", r*0xff/a, g*0xff/a, b*0xff/a, float64(a)/0xffff)
+}
+
+func svgStyle(style Style) string {
+	return fmt.Sprintf(`fill="%s" stroke="%s" stroke-width="%.2f"`, svgColor(style.Fill), svgColor(style.Stroke), style.Width)
+}
+
+func (c *SVGCanvas) Polyline(points []Point, closed bool, style Style) {
+	coords := make([]string, len(points))
+	for i, p := range points {
+		coords[i] = fmt.Sprintf("%.2f,%.2f", p.X, p.Y)
+	}
+	element := "polyline"
+	if closed {
+		element = "polygon"
+	}
+	fmt.Fprintf(&c.body, "<%s points=\"%s\" %s/>\n", element, strings.Join(coords, " "), svgStyle(style))
+}
+
+func (c *SVGCanvas) Circle(centre Point, radius float64, style Style) {
+	fmt.Fprintf(&c.body, "<circle cx=\"%.2f\" cy=\"%.2f\" r=\"%.2f\" %s/>\n", centre.X, centre.Y, radius, svgStyle(style))
+}
+
+var svgEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+func (c *SVGCanvas) Text(at Point, text string, size float64, col color.Color) {
+	fmt.Fprintf(&c.body, "<text x=\"%.2f\" y=\"%.2f\" font-family=\"sans-serif\" font-size=\"%.1f\" fill=\"%s\">%s</text>\n",
+		at.X, at.Y, size, svgColor(col), svgEscaper.Replace(text))
+}
+
+func (c *SVGCanvas) WriteTo(w io.Writer) (int64, error) {
+	var doc bytes.Buffer
+	fmt.Fprintf(&doc, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%.0f\" height=\"%.0f\" viewBox=\"0 0 %.0f %.0f\">\n",
+		c.width, c.height, c.width, c.height)
+	fmt.Fprintf(&doc, "<rect width=\"100%%\" height=\"100%%\" fill=\"white\"/>\n")
+	doc.Write(c.body.Bytes())
+	doc.WriteString("</svg>\n")
+	return doc.WriteTo(w)
+}
+
+// PNGCanvas draws into an anti-aliased raster image. WriteTo encodes it as PNG.
+type PNGCanvas struct {
+	ctx   *gg.Context
+	faces map[float64]font.Face
+}
+
+func NewPNGCanvas(width, height float64) *PNGCanvas {
+	ctx := gg.NewContext(int(width+0.5), int(height+0.5))
+	ctx.SetColor(color.White)
+	ctx.Clear()
+	return &PNGCanvas{ctx: ctx, faces: make(map[float64]font.Face)}
+}
+
+func (c *PNGCanvas) paint(style Style) {
+	if style.Fill != nil {
+		c.ctx.SetColor(style.Fill)
+		if style.Stroke != nil {
+			c.ctx.FillPreserve()
+		} else {
+			c.ctx.Fill()
+		}
+	}
+	if style.Stroke != nil {
+		c.ctx.SetColor(style.Stroke)
+		c.ctx.SetLineWidth(style.Width)
+		c.ctx.Stroke()
+	}
+	c.ctx.ClearPath()
+}
+
+func (c *PNGCanvas) Polyline(points []Point, closed bool, style Style) {
+	for _, p := range points {
+		c.ctx.LineTo(p.X, p.Y)
+	}
+	if closed {
+		c.ctx.ClosePath()
+	}
+	c.paint(style)
+}
+
+func (c *PNGCanvas) Circle(centre Point, radius float64, style Style) {
+	c.ctx.DrawCircle(centre.X, centre.Y, radius)
+	c.paint(style)
+}
+
+func (c *PNGCanvas) Text(at Point, text string, size float64, col color.Color) {
+	face, ok := c.faces[size]
+	if !ok {
+		// goregular is a valid font bundled with x/image, parsing it cannot fail
+		f, _ := truetype.Parse(goregular.TTF)
+		face = truetype.NewFace(f, &truetype.Options{Size: size})
+		c.faces[size] = face
+	}
+	c.ctx.SetFontFace(face)
+	c.ctx.SetColor(col)
+	c.ctx.DrawString(text, at.X, at.Y)
+}
+
+func (c *PNGCanvas) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, c.ctx.Image()); err != nil {
+		return 0, err
+	}
+	return buf.WriteTo(w)
+}
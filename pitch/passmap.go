@@ -0,0 +1,122 @@
+package pitch
+
+import (
+	"image/color"
+	"io"
+	"math"
+	"sort"
+)
+
+// Arrow is a pass or any other event moving the ball from From to To, coloured by Label.
+type Arrow struct {
+	From, To Point
+	Label    string
+}
+
+// DrawArrow draws a line from one point of the pitch to another, with a head of headLength metres at its end.
+func DrawArrow(c Canvas, f Frame, from, to Point, headLength float64, style Style) {
+	line := style
+	line.Fill = nil
+	c.Polyline(f.path(from, to), false, line)
+
+	dx, dy := to.X-from.X, to.Y-from.Y
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return
+	}
+	if headLength > length/2 {
+		headLength = length / 2
+	}
+	ux, uy := dx/length, dy/length
+	base := Point{to.X - ux*headLength, to.Y - uy*headLength}
+	half := headLength / 2
+	head := []Point{to, {base.X - uy*half, base.Y + ux*half}, {base.X + uy*half, base.Y - ux*half}}
+	c.Polyline(f.path(head...), true, Style{Fill: style.Stroke})
+}
+
+// PassMap draws arrows on a single pitch, with a legend of their labels and lines of text, e.g. summary
+// statistics, below.
+type PassMap struct {
+	Title  string
+	Arrows []Arrow
+	Notes  []string
+	Colors map[string]color.Color // colour of a label, labels not in it take the Palette
+	Scale  float64
+}
+
+// NewPassMap returns a pass map with the default scale.
+func NewPassMap(title string, arrows []Arrow, notes []string) *PassMap {
+	return &PassMap{Title: title, Arrows: arrows, Notes: notes, Colors: make(map[string]color.Color), Scale: 8}
+}
+
+func (m *PassMap) labels() []string {
+	seen := make(map[string]bool)
+	labels := make([]string, 0)
+	for _, a := range m.Arrows {
+		if !seen[a.Label] {
+			seen[a.Label] = true
+			labels = append(labels, a.Label)
+		}
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+func (m *PassMap) colors() map[string]color.Color {
+	colors := make(map[string]color.Color)
+	for i, label := range m.labels() {
+		if c, ok := m.Colors[label]; ok {
+			colors[label] = c
+		} else {
+			colors[label] = Palette[i%len(Palette)]
+		}
+	}
+	return colors
+}
+
+// Size is the size of the pass map in pixels.
+func (m *PassMap) Size() (width, height float64) {
+	width = 2*margin + (Length+2*pitchPadding)*m.Scale
+	height = 2*margin + titleHeight + (Width+2*pitchPadding)*m.Scale + float64(len(m.labels())+len(m.Notes))*legendRow
+	return
+}
+
+// Draw draws the pitch, the arrows in the order given, the legend and the notes.
+func (m *PassMap) Draw(c Canvas) {
+	c.Text(Point{margin, margin + titleHeight*0.6}, m.Title, 22, textColor)
+	f := Frame{Origin: Point{margin + pitchPadding*m.Scale, margin + titleHeight + (Width+pitchPadding)*m.Scale}, Scale: m.Scale}
+	DrawPitch(c, f, pitchStyle)
+
+	colors := m.colors()
+	for _, a := range m.Arrows {
+		DrawArrow(c, f, a.From, a.To, 1.5, Style{Stroke: transparent(colors[a.Label], 0xb0), Width: 1.5})
+	}
+
+	y := margin + titleHeight + (Width+2*pitchPadding)*m.Scale
+	for _, label := range m.labels() {
+		y += legendRow
+		col := colors[label]
+		c.Polyline([]Point{{margin, y - 5}, {margin + 14, y - 5}}, false, Style{Stroke: col, Width: 3})
+		c.Text(Point{margin + 22, y}, label, 13, textColor)
+	}
+	for _, note := range m.Notes {
+		y += legendRow
+		c.Text(Point{margin, y}, note, 13, textColor)
+	}
+}
+
+// WriteSVG renders the pass map as an SVG document.
+func (m *PassMap) WriteSVG(w io.Writer) error {
+	c := NewSVGCanvas(m.Size())
+	m.Draw(c)
+	_, err := c.WriteTo(w)
+	return err
+}
+
+// WritePNG renders the pass map as a PNG image.
+func (m *PassMap) WritePNG(w io.Writer) error {
+	c := NewPNGCanvas(m.Size())
+	m.Draw(c)
+	_, err := c.WriteTo(w)
+	return err
+}
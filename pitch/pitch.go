@@ -0,0 +1,118 @@
+// Package pitch draws football pitches and the events of players on them, as SVG or PNG images.
+//
+// Positions are given in metres on a 105x68 pitch with the origin in the bottom left corner, the frame the crawler
+// stores as pitch_x1, pitch_y1 etc.
+package pitch
+
+import (
+	"image/color"
+	"math"
+)
+
+// Dimensions of the pitch and its markings, in metres.
+const (
+	Length = 105.0
+	Width  = 68.0
+
+	penaltyAreaDepth   = 16.5
+	penaltyAreaWidth   = 40.32
+	goalAreaDepth      = 5.5
+	goalAreaWidth      = 18.32
+	goalWidth          = 7.32
+	goalDepth          = 2.0
+	centreCircleRadius = 9.15
+	penaltySpotDist    = 11.0
+	spotRadius         = 0.3
+)
+
+// Point is a position on the pitch in metres, or on a canvas in pixels.
+type Point struct {
+	X, Y float64
+}
+
+// Style is how a shape is drawn. A nil Stroke or Fill leaves the outline or the inside out.
+type Style struct {
+	Stroke color.Color
+	Fill   color.Color
+	Width  float64
+}
+
+// Canvas is a drawing surface measured in pixels, with y growing downwards.
+type Canvas interface {
+	Polyline(points []Point, closed bool, style Style)
+	Circle(centre Point, radius float64, style Style)
+	Text(at Point, text string, size float64, c color.Color)
+}
+
+// Frame maps pitch coordinates onto a canvas: the bottom left corner of the pitch is drawn at Origin, and one metre
+// is Scale pixels long.
+type Frame struct {
+	Origin Point
+	Scale  float64
+}
+
+// At returns the canvas position of a point on the pitch.
+func (f Frame) At(p Point) Point {
+	return Point{f.Origin.X + p.X*f.Scale, f.Origin.Y - p.Y*f.Scale}
+}
+
+func (f Frame) path(points ...Point) []Point {
+	path := make([]Point, len(points))
+	for i, p := range points {
+		path[i] = f.At(p)
+	}
+	return path
+}
+
+func rect(x1, y1, x2, y2 float64) []Point {
+	return []Point{{x1, y1}, {x2, y1}, {x2, y2}, {x1, y2}}
+}
+
+// arc approximates the part of a circle between two angles, in radians, with a polyline.
+func arc(centre Point, radius, from, to float64) []Point {
+	n := 32
+	points := make([]Point, n+1)
+	for i := 0; i <= n; i++ {
+		a := from + (to-from)*float64(i)/float64(n)
+		points[i] = Point{centre.X + radius*math.Cos(a), centre.Y + radius*math.Sin(a)}
+	}
+	return points
+}
+
+// DrawPitch draws the boundary, halfway line, centre circle, penalty and goal areas, penalty spots and arcs and
+// the goals of a pitch.
+func DrawPitch(c Canvas, f Frame, style Style) {
+	lines := style
+	lines.Fill = nil
+	spots := Style{Fill: style.Stroke}
+
+	if style.Fill != nil {
+		c.Polyline(f.path(rect(0, 0, Length, Width)...), true, Style{Fill: style.Fill})
+	}
+	if style.Stroke == nil {
+		return
+	}
+	c.Polyline(f.path(rect(0, 0, Length, Width)...), true, lines)
+	c.Polyline(f.path(Point{Length / 2, 0}, Point{Length / 2, Width}), false, lines)
+	c.Circle(f.At(Point{Length / 2, Width / 2}), centreCircleRadius*f.Scale, lines)
+	c.Circle(f.At(Point{Length / 2, Width / 2}), spotRadius*f.Scale, spots)
+
+	// the penalty arc is the part of the circle around the penalty spot outside the penalty area
+	arcAngle := math.Acos((penaltyAreaDepth - penaltySpotDist) / centreCircleRadius)
+	for _, side := range []struct {
+		goalLine, inwards float64
+	}{{0, 1}, {Length, -1}} {
+		x := func(d float64) float64 { return side.goalLine + side.inwards*d }
+		c.Polyline(f.path(rect(x(0), (Width-penaltyAreaWidth)/2, x(penaltyAreaDepth), (Width+penaltyAreaWidth)/2)...), false, lines)
+		c.Polyline(f.path(rect(x(0), (Width-goalAreaWidth)/2, x(goalAreaDepth), (Width+goalAreaWidth)/2)...), false, lines)
+		c.Polyline(f.path(rect(x(0), (Width-goalWidth)/2, x(-goalDepth), (Width+goalWidth)/2)...), false, lines)
+
+		spot := Point{x(penaltySpotDist), Width / 2}
+		c.Circle(f.At(spot), spotRadius*f.Scale, spots)
+		from := -arcAngle
+		if side.inwards < 0 {
+			from += math.Pi
+		}
+		c.Polyline(f.path(arc(spot, centreCircleRadius, from, from+2*arcAngle)...), false, lines)
+	}
+}
@@ -0,0 +1,182 @@
+package pitch
+
+import (
+	"image/color"
+	"io"
+	"math"
+	"sort"
+)
+
+// Event is one point of a scatter plot. Events are drawn on the facet named Facet, coloured by Label.
+type Event struct {
+	X, Y   float64
+	Facet  string
+	Label  string
+	Radius float64 // radius of the marker in metres, 0 for the Radius of the plot
+}
+
+// Palette colours the labels of a plot, in the order the labels sort in.
+var Palette = []color.Color{
+	color.RGBA{0x1f, 0x77, 0xb4, 0xff},
+	color.RGBA{0xd6, 0x27, 0x28, 0xff},
+	color.RGBA{0x2c, 0xa0, 0x2c, 0xff},
+	color.RGBA{0xff, 0x7f, 0x0e, 0xff},
+	color.RGBA{0x94, 0x67, 0xbd, 0xff},
+	color.RGBA{0x8c, 0x56, 0x4b, 0xff},
+	color.RGBA{0xe3, 0x77, 0xc2, 0xff},
+	color.RGBA{0x7f, 0x7f, 0x7f, 0xff},
+	color.RGBA{0xbc, 0xbd, 0x22, 0xff},
+	color.RGBA{0x17, 0xbe, 0xcf, 0xff},
+}
+
+var (
+	pitchStyle = Style{Stroke: color.Gray{0x60}, Fill: color.RGBA{0xf4, 0xf8, 0xf0, 0xff}, Width: 1.5}
+	textColor  = color.Gray{0x20}
+)
+
+const (
+	margin       = 20.0
+	titleHeight  = 40.0
+	facetTitle   = 24.0
+	legendRow    = 22.0
+	legendColumn = 220.0
+	pitchPadding = 4.0 // metres around the pitch, leaving room for the goals and events just outside the lines
+)
+
+// Plot is a scatter plot of events, one pitch per facet, like ggplot's facet_wrap.
+type Plot struct {
+	Title   string
+	Events  []Event
+	Scale   float64 // pixels per metre
+	Columns int     // facets per row, 0 picks a roughly square grid
+	Radius  float64 // radius of the event markers in metres
+}
+
+// NewPlot returns a plot with the default scale and marker size.
+func NewPlot(title string, events []Event) *Plot {
+	return &Plot{Title: title, Events: events, Scale: 6, Radius: 0.9}
+}
+
+func distinct(events []Event, key func(Event) string) []string {
+	seen := make(map[string]bool)
+	values := make([]string, 0)
+	for _, e := range events {
+		if v := key(e); !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+func (p *Plot) facets() []string {
+	return distinct(p.Events, func(e Event) string { return e.Facet })
+}
+
+func (p *Plot) labels() []string {
+	return distinct(p.Events, func(e Event) string { return e.Label })
+}
+
+func (p *Plot) grid() (columns, rows int) {
+	n := len(p.facets())
+	if n == 0 {
+		n = 1
+	}
+	columns = p.Columns
+	if columns < 1 {
+		columns = int(math.Ceil(math.Sqrt(float64(n))))
+	}
+	if columns > n {
+		columns = n
+	}
+	return columns, (n + columns - 1) / columns
+}
+
+func (p *Plot) cellSize() (width, height float64) {
+	return (Length + 2*pitchPadding) * p.Scale, (Width+2*pitchPadding)*p.Scale + facetTitle
+}
+
+func (p *Plot) legendLayout(width float64) (perRow, rows int) {
+	perRow = int((width - 2*margin) / legendColumn)
+	if perRow < 1 {
+		perRow = 1
+	}
+	n := len(p.labels())
+	return perRow, (n + perRow - 1) / perRow
+}
+
+// Size is the size of the plot in pixels.
+func (p *Plot) Size() (width, height float64) {
+	columns, rows := p.grid()
+	cellWidth, cellHeight := p.cellSize()
+	width = 2*margin + float64(columns)*cellWidth
+	_, legendRows := p.legendLayout(width)
+	height = 2*margin + titleHeight + float64(rows)*cellHeight + float64(legendRows)*legendRow
+	return
+}
+
+// Draw draws the plot onto c, which has to be at least Size large.
+func (p *Plot) Draw(c Canvas) {
+	width, _ := p.Size()
+	columns, rows := p.grid()
+	cellWidth, cellHeight := p.cellSize()
+
+	colors := make(map[string]color.Color)
+	for i, label := range p.labels() {
+		colors[label] = Palette[i%len(Palette)]
+	}
+
+	c.Text(Point{margin, margin + titleHeight*0.6}, p.Title, 22, textColor)
+
+	for i, facet := range p.facets() {
+		left := margin + float64(i%columns)*cellWidth
+		top := margin + titleHeight + float64(i/columns)*cellHeight
+		c.Text(Point{left + pitchPadding*p.Scale, top + facetTitle*0.7}, facet, 15, textColor)
+
+		f := Frame{Origin: Point{left + pitchPadding*p.Scale, top + facetTitle + (Width+pitchPadding)*p.Scale}, Scale: p.Scale}
+		DrawPitch(c, f, pitchStyle)
+		for _, e := range p.Events {
+			if e.Facet != facet {
+				continue
+			}
+			col := colors[e.Label]
+			radius := p.Radius
+			if e.Radius > 0 {
+				radius = e.Radius
+			}
+			c.Circle(f.At(Point{e.X, e.Y}), radius*p.Scale, Style{Stroke: col, Fill: transparent(col, 0x50), Width: 1})
+		}
+	}
+
+	perRow, _ := p.legendLayout(width)
+	legendTop := margin + titleHeight + float64(rows)*cellHeight
+	for i, label := range p.labels() {
+		x := margin + float64(i%perRow)*legendColumn
+		y := legendTop + float64(i/perRow)*legendRow + legendRow/2
+		col := colors[label]
+		c.Circle(Point{x + 6, y}, 6, Style{Stroke: col, Fill: transparent(col, 0x50), Width: 1})
+		c.Text(Point{x + 18, y + 5}, label, 13, textColor)
+	}
+}
+
+func transparent(c color.Color, alpha uint8) color.Color {
+	r, g, b, _ := c.RGBA()
+	return color.NRGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), alpha}
+}
+
+// WriteSVG renders the plot as an SVG document.
+func (p *Plot) WriteSVG(w io.Writer) error {
+	c := NewSVGCanvas(p.Size())
+	p.Draw(c)
+	_, err := c.WriteTo(w)
+	return err
+}
+
+// WritePNG renders the plot as a PNG image.
+func (p *Plot) WritePNG(w io.Writer) error {
+	c := NewPNGCanvas(p.Size())
+	p.Draw(c)
+	_, err := c.WriteTo(w)
+	return err
+}
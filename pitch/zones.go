@@ -0,0 +1,239 @@
+package pitch
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+)
+
+// Sample is an event to aggregate: where it happened and whether it succeeded.
+type Sample struct {
+	X, Y    float64
+	Success bool
+}
+
+// Matrix holds one value per zone, indexed [row][column]. Row 0 is at the bottom of the pitch and column 0 at the
+// left, the team attacking towards the last column.
+type Matrix [][]float64
+
+func newMatrix(columns, rows int) Matrix {
+	m := make(Matrix, rows)
+	for i, _ := range m {
+		m[i] = make([]float64, columns)
+	}
+	return m
+}
+
+// Max is the largest value of the matrix, ignoring zones without a value (NaN).
+func (m Matrix) Max() float64 {
+	max := math.NaN()
+	for _, row := range m {
+		for _, v := range row {
+			if !math.IsNaN(v) && (math.IsNaN(max) || v > max) {
+				max = v
+			}
+		}
+	}
+	return max
+}
+
+// Grid divides the pitch into zones between the given edges, in metres. XEdges run from 0 to Length and YEdges
+// from 0 to Width.
+type Grid struct {
+	XEdges, YEdges []float64
+}
+
+func edges(n int, length float64) []float64 {
+	e := make([]float64, n+1)
+	for i, _ := range e {
+		e[i] = length * float64(i) / float64(n)
+	}
+	return e
+}
+
+// NewGrid divides the pitch into columns by rows zones of equal size, e.g. NewGrid(6, 4).
+func NewGrid(columns, rows int) Grid {
+	return Grid{edges(columns, Length), edges(rows, Width)}
+}
+
+// EighteenZones is the 6 by 3 grid of Juego de Posición: thirds of the pitch split into halves lengthwise, and a
+// centre channel between the two wings across.
+func EighteenZones() Grid {
+	return NewGrid(6, 3)
+}
+
+func (g Grid) Columns() int {
+	return len(g.XEdges) - 1
+}
+
+func (g Grid) Rows() int {
+	return len(g.YEdges) - 1
+}
+
+func bin(edges []float64, v float64) int {
+	if v < edges[0] || v > edges[len(edges)-1] {
+		return -1
+	}
+	for i := 1; i < len(edges)-1; i++ {
+		if v < edges[i] {
+			return i - 1
+		}
+	}
+	return len(edges) - 2
+}
+
+// Zone returns the column and row of the zone p is in, ok is false for points off the pitch.
+func (g Grid) Zone(p Point) (column, row int, ok bool) {
+	column, row = bin(g.XEdges, p.X), bin(g.YEdges, p.Y)
+	return column, row, column >= 0 && row >= 0
+}
+
+// Counts is the number of samples in every zone.
+func (g Grid) Counts(samples []Sample) Matrix {
+	m := newMatrix(g.Columns(), g.Rows())
+	for _, s := range samples {
+		if column, row, ok := g.Zone(Point{s.X, s.Y}); ok {
+			m[row][column]++
+		}
+	}
+	return m
+}
+
+// SuccessRates is the share of successful samples in every zone, NaN for zones without samples.
+func (g Grid) SuccessRates(samples []Sample) Matrix {
+	counts := g.Counts(samples)
+	m := newMatrix(g.Columns(), g.Rows())
+	for _, s := range samples {
+		if column, row, ok := g.Zone(Point{s.X, s.Y}); ok && s.Success {
+			m[row][column]++
+		}
+	}
+	for row, _ := range m {
+		for column, _ := range m[row] {
+			if counts[row][column] == 0 {
+				m[row][column] = math.NaN()
+			} else {
+				m[row][column] /= counts[row][column]
+			}
+		}
+	}
+	return m
+}
+
+// Density estimates the density of samples per square metre with a gaussian kernel of bandwidth metres, evaluated
+// at the centres of a fine columns by rows grid of the pitch.
+func Density(samples []Sample, bandwidth float64, columns, rows int) Matrix {
+	m := newMatrix(columns, rows)
+	if len(samples) == 0 || bandwidth <= 0 {
+		return m
+	}
+	norm := 1 / (2 * math.Pi * bandwidth * bandwidth * float64(len(samples)))
+	for row, _ := range m {
+		y := (float64(row) + 0.5) * Width / float64(rows)
+		for column, _ := range m[row] {
+			x := (float64(column) + 0.5) * Length / float64(columns)
+			var sum float64
+			for _, s := range samples {
+				dx, dy := (x-s.X)/bandwidth, (y-s.Y)/bandwidth
+				sum += math.Exp(-(dx*dx + dy*dy) / 2)
+			}
+			m[row][column] = sum * norm
+		}
+	}
+	return m
+}
+
+// Heat is a sequential colour scale from pale yellow at 0 to dark red at 1.
+func Heat(t float64) color.Color {
+	t = math.Max(0, math.Min(1, t))
+	stops := []color.NRGBA{{0xff, 0xff, 0xcc, 0xff}, {0xfd, 0x8d, 0x3c, 0xff}, {0xbd, 0x00, 0x26, 0xff}}
+	pos := t * float64(len(stops)-1)
+	i := int(pos)
+	if i >= len(stops)-1 {
+		return stops[len(stops)-1]
+	}
+	f := pos - float64(i)
+	mix := func(a, b uint8) uint8 { return uint8(float64(a) + (float64(b)-float64(a))*f + 0.5) }
+	a, b := stops[i], stops[i+1]
+	return color.NRGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 0xff}
+}
+
+// DrawMatrix fills the zones of g on the pitch framed by f with the colour of their value relative to max, leaving
+// zones without a value empty. With a non empty format every zone is labelled with its value.
+func DrawMatrix(c Canvas, f Frame, g Grid, m Matrix, max float64, alpha uint8, format string) {
+	for row := 0; row < g.Rows(); row++ {
+		for column := 0; column < g.Columns(); column++ {
+			v := m[row][column]
+			if math.IsNaN(v) {
+				continue
+			}
+			t := 0.0
+			if max > 0 {
+				t = v / max
+			}
+			x1, x2, y1, y2 := g.XEdges[column], g.XEdges[column+1], g.YEdges[row], g.YEdges[row+1]
+			c.Polyline(f.path(rect(x1, y1, x2, y2)...), true, Style{Fill: transparent(Heat(t), alpha)})
+			if format != "" {
+				at := f.At(Point{(x1 + x2) / 2, (y1 + y2) / 2})
+				c.Text(Point{at.X - 12, at.Y + 5}, fmt.Sprintf(format, v), 13, textColor)
+			}
+		}
+	}
+}
+
+// Overlay is a pitch with a matrix drawn over it: zone counts or success rates of a Grid, or a Density.
+type Overlay struct {
+	Title  string
+	Grid   Grid
+	Values Matrix
+	Format string // label of every zone, e.g. "%.0f" or "%.0f%%", empty for no labels
+	Scale  float64
+}
+
+// NewZoneOverlay shows values of the zones of g, labelled with format.
+func NewZoneOverlay(title string, g Grid, values Matrix, format string) *Overlay {
+	return &Overlay{Title: title, Grid: g, Values: values, Format: format, Scale: 8}
+}
+
+// NewDensityOverlay shows a Density as a heatmap without labels.
+func NewDensityOverlay(title string, density Matrix) *Overlay {
+	columns, rows := 0, len(density)
+	if rows > 0 {
+		columns = len(density[0])
+	}
+	return &Overlay{Title: title, Grid: NewGrid(columns, rows), Values: density, Scale: 8}
+}
+
+// Size is the size of the overlay in pixels.
+func (o *Overlay) Size() (width, height float64) {
+	return 2*margin + (Length+2*pitchPadding)*o.Scale, 2*margin + titleHeight + (Width+2*pitchPadding)*o.Scale
+}
+
+// Draw draws the pitch, the matrix over it and the pitch markings again on top, so they stay visible.
+func (o *Overlay) Draw(c Canvas) {
+	c.Text(Point{margin, margin + titleHeight*0.6}, o.Title, 22, textColor)
+	f := Frame{Origin: Point{margin + pitchPadding*o.Scale, margin + titleHeight + (Width+pitchPadding)*o.Scale}, Scale: o.Scale}
+
+	DrawPitch(c, f, Style{Fill: pitchStyle.Fill})
+	DrawMatrix(c, f, o.Grid, o.Values, o.Values.Max(), 0xc0, o.Format)
+	lines := pitchStyle
+	lines.Fill = nil
+	DrawPitch(c, f, lines)
+}
+
+// WriteSVG renders the overlay as an SVG document.
+func (o *Overlay) WriteSVG(w io.Writer) error {
+	c := NewSVGCanvas(o.Size())
+	o.Draw(c)
+	_, err := c.WriteTo(w)
+	return err
+}
+
+// WritePNG renders the overlay as a PNG image.
+func (o *Overlay) WritePNG(w io.Writer) error {
+	c := NewPNGCanvas(o.Size())
+	o.Draw(c)
+	_, err := c.WriteTo(w)
+	return err
+}
@@ -0,0 +1,107 @@
+package pitch
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGridZone(t *testing.T) {
+	g := NewGrid(6, 4)
+	for _, c := range []struct {
+		name        string
+		p           Point
+		column, row int
+		ok          bool
+	}{
+		{"origin", Point{0, 0}, 0, 0, true},
+		{"first edge", Point{Length / 6, Width / 4}, 1, 1, true},
+		{"just before an edge", Point{Length/6 - 0.01, Width/4 - 0.01}, 0, 0, true},
+		{"centre spot", Point{Length / 2, Width / 2}, 3, 2, true},
+		{"goal line", Point{Length, Width / 2}, 5, 2, true},
+		{"top touchline", Point{Length / 2, Width}, 3, 3, true},
+		{"top right corner", Point{Length, Width}, 5, 3, true},
+		{"behind the goal", Point{Length + 0.01, Width / 2}, 0, 0, false},
+		{"off the bottom touchline", Point{Length / 2, -0.01}, 0, 0, false},
+	} {
+		column, row, ok := g.Zone(c.p)
+		if ok != c.ok || ok && (column != c.column || row != c.row) {
+			t.Errorf("%s: Zone(%v) = %d, %d, %v, want %d, %d, %v", c.name, c.p, column, row, ok, c.column, c.row, c.ok)
+		}
+	}
+}
+
+func TestEighteenZones(t *testing.T) {
+	g := EighteenZones()
+	if g.Columns() != 6 || g.Rows() != 3 {
+		t.Fatalf("EighteenZones is %dx%d, want 6x3", g.Columns(), g.Rows())
+	}
+	if g.XEdges[6] != Length || g.YEdges[3] != Width {
+		t.Errorf("EighteenZones ends at %v, %v, want %v, %v", g.XEdges[6], g.YEdges[3], Length, Width)
+	}
+}
+
+func TestCountsAndSuccessRates(t *testing.T) {
+	g := NewGrid(2, 2)
+	samples := []Sample{
+		{10, 10, true}, {20, 20, false}, {0, 0, true}, // bottom left
+		{Length, Width, true},          // top right, on the corner
+		{Length / 2, Width / 2, false}, // centre spot, top right
+		{Length + 1, 10, true},         // off the pitch
+	}
+	counts := g.Counts(samples)
+	if want := (Matrix{{3, 0}, {0, 2}}); !equalMatrix(counts, want) {
+		t.Errorf("Counts = %v, want %v", counts, want)
+	}
+	rates := g.SuccessRates(samples)
+	if want := (Matrix{{2.0 / 3, math.NaN()}, {math.NaN(), 0.5}}); !equalMatrix(rates, want) {
+		t.Errorf("SuccessRates = %v, want %v", rates, want)
+	}
+	if max := rates.Max(); max != 2.0/3 {
+		t.Errorf("Max = %v, want %v", max, 2.0/3)
+	}
+}
+
+func TestDensity(t *testing.T) {
+	if m := Density(nil, 5, 4, 2); m.Max() != 0 {
+		t.Errorf("Density without samples = %v, want zeros", m)
+	}
+
+	// one sample in the middle of the bottom left zone of a 2x2 grid
+	samples := []Sample{{Length / 4, Width / 4, true}}
+	m := Density(samples, 5, 2, 2)
+	if want := 1 / (2 * math.Pi * 25); math.Abs(m[0][0]-want) > 1e-12 {
+		t.Errorf("density at the sample = %v, want %v", m[0][0], want)
+	}
+	if !(m[0][0] > m[0][1] && m[0][1] > m[1][1] && m[0][1] > 0) {
+		t.Errorf("density does not fall away from the sample: %v", m)
+	}
+
+	// the density integrates to about 1 over a fine grid when the kernel is well inside the pitch
+	fine := Density([]Sample{{Length / 2, Width / 2, true}}, 3, 210, 136)
+	var sum float64
+	for _, row := range fine {
+		for _, v := range row {
+			sum += v
+		}
+	}
+	if area := (Length / 210) * (Width / 136); math.Abs(sum*area-1) > 1e-3 {
+		t.Errorf("density integrates to %v, want 1", sum*area)
+	}
+}
+
+func equalMatrix(a, b Matrix) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, _ := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for j, _ := range a[i] {
+			if math.IsNaN(a[i][j]) != math.IsNaN(b[i][j]) || !math.IsNaN(a[i][j]) && math.Abs(a[i][j]-b[i][j]) > 1e-12 {
+				return false
+			}
+		}
+	}
+	return true
+}
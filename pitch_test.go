@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+)
+
+// event is an event of type eventType in half, going from x1 to x2 across the middle of the raw pitch.
+func event(half int, eventType string, x1, x2 float64) PlayerEvent {
+	return PlayerEvent{EventHalf: half, EventType: eventType, StartPoint: Point{x1, 265}, EndPoint: Point{x2, 265}}
+}
+
+// attackingRight are events of a team attacking right: shots near the right goal, tackles near the left one.
+func attackingRight(half int) []PlayerEvent {
+	return []PlayerEvent{event(half, "shot_on_target", 620, 680), event(half, "def_tackle_success", 120, 120)}
+}
+
+func attackingLeft(half int) []PlayerEvent {
+	return []PlayerEvent{event(half, "shot_on_target", 120, 60), event(half, "def_tackle_success", 620, 620)}
+}
+
+// ambiguous are events that say nothing about the direction of play.
+func ambiguous(half int) []PlayerEvent {
+	return []PlayerEvent{event(half, "aerial_duel_won", 370, 370)}
+}
+
+func teamPlayer(team string, events ...[]PlayerEvent) *PlayerStats {
+	all := []PlayerEvent{}
+	for _, e := range events {
+		all = append(all, e...)
+	}
+	return &PlayerStats{TeamName: team, Events: &all}
+}
+
+func TestPlayDirections(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		players []*PlayerStats
+		// directions of the home team in the first and second half, the away team plays the other way
+		first, second bool
+	}{
+		{"both teams clear",
+			[]*PlayerStats{teamPlayer("Home", attackingRight(1), attackingLeft(2)), teamPlayer("Away", attackingLeft(1), attackingRight(2))},
+			true, false},
+		{"away team ambiguous",
+			[]*PlayerStats{teamPlayer("Home", attackingLeft(1), attackingRight(2)), teamPlayer("Away", ambiguous(1), ambiguous(2))},
+			false, true},
+		{"home team ambiguous",
+			[]*PlayerStats{teamPlayer("Home", ambiguous(1), ambiguous(2)), teamPlayer("Away", attackingLeft(1), attackingRight(2))},
+			true, false},
+		{"second half ambiguous",
+			[]*PlayerStats{teamPlayer("Home", attackingRight(1), ambiguous(2)), teamPlayer("Away", ambiguous(1), ambiguous(2))},
+			true, false},
+		{"only second half events",
+			[]*PlayerStats{teamPlayer("Home", attackingRight(2)), teamPlayer("Away", attackingLeft(2))},
+			false, true},
+		{"conflicting evidence, the stronger wins",
+			[]*PlayerStats{teamPlayer("Home", attackingRight(1), attackingLeft(2)),
+				teamPlayer("Away", []PlayerEvent{event(1, "pass_success", 300, 310)})},
+			true, false},
+		{"passes only",
+			[]*PlayerStats{teamPlayer("Home", []PlayerEvent{event(1, "pass_success", 500, 400), event(2, "pass_success", 200, 300)}),
+				teamPlayer("Away", ambiguous(1))},
+			false, true},
+	} {
+		directions := PlayDirections(c.players)
+		for _, want := range []struct {
+			team  string
+			half  int
+			right bool
+		}{{"Home", 1, c.first}, {"Home", 2, c.second}, {"Away", 1, !c.first}, {"Away", 2, !c.second}} {
+			right, ok := directions[playDirectionKey{want.team, want.half}]
+			if !ok || right != want.right {
+				t.Errorf("%s: %s attacking right in half %d = %v (found %v), want %v", c.name, want.team, want.half,
+					right, ok, want.right)
+			}
+		}
+	}
+}
+
+func TestPlayDirectionsOfExtraTime(t *testing.T) {
+	directions := PlayDirections([]*PlayerStats{
+		teamPlayer("Home", attackingRight(1), attackingLeft(3)),
+		teamPlayer("Away", ambiguous(2), ambiguous(4))})
+	for key, want := range map[playDirectionKey]bool{
+		{"Home", 1}: true, {"Home", 2}: false, {"Home", 3}: false, {"Home", 4}: true,
+		{"Away", 1}: false, {"Away", 2}: true, {"Away", 3}: true, {"Away", 4}: false} {
+		if right, ok := directions[key]; !ok || right != want {
+			t.Errorf("%s attacking right in half %d = %v (found %v), want %v", key.team, key.half, right, ok, want)
+		}
+	}
+}
+
+func TestIsAttackingRight(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		events []PlayerEvent
+		want   bool
+	}{
+		{"attacks right", attackingRight(1), true},
+		{"attacks left", attackingLeft(1), false},
+		{"passes left", []PlayerEvent{event(1, "pass_success", 400, 300), event(1, "pass_fail", 300, 600)}, false},
+		{"no evidence", ambiguous(1), true},
+	} {
+		if got := IsAttackingRight(c.events); got != c.want {
+			t.Errorf("%s: IsAttackingRight = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
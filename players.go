@@ -0,0 +1,97 @@
+package main
+
+import (
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// PlayerName is one spelling of a player's name, with the dates of the first and last match it was seen in.
+type PlayerName struct {
+	PlayerId  string     `db:"player_id"`
+	Name      string     `db:"name"`
+	FirstSeen *time.Time `db:"first_seen"`
+	LastSeen  *time.Time `db:"last_seen"`
+}
+
+// Appearance is one match a player took part in.
+type Appearance struct {
+	PlayerStatsId int64      `db:"player_stats_id"`
+	MatchId       string     `db:"match_id"`
+	MatchDate     *time.Time `db:"match_date"`
+	Season        int        `db:"season"`
+	LeagueId      string     `db:"league_id"`
+	TeamName      string     `db:"team_name"`
+	HomeTeamName  string     `db:"home_team_name"`
+	AwayTeamName  string     `db:"away_team_name"`
+	HomeScore     int        `db:"home_score"`
+	AwayScore     int        `db:"away_score"`
+	IsSubstitute  bool       `db:"is_substitute"`
+	MinuteOn      *int       `db:"minute_on"`
+	MinuteOff     *int       `db:"minute_off"`
+	SentOff       bool       `db:"sent_off"`
+	Events        int64      `db:"events"`
+}
+
+// playerRegistryWriter records the players seen on player stats pages in the player and player_name tables.
+// The canonical name of a player is the one seen in their most recent match.
+type playerRegistryWriter struct {
+	s *Statements
+}
+
+func newPlayerRegistryWriter(s *Statements) *playerRegistryWriter {
+	return &playerRegistryWriter{s}
+}
+
+// Write records that ps.PlayerId played under ps.PlayerName in a match played on matchDate, which may be nil.
+func (w *playerRegistryWriter) Write(ps *PlayerStats, matchDate *time.Time) error {
+	if ps.PlayerId == "" || ps.PlayerName == "" {
+		return nil
+	}
+	if _, err := w.s.Exec("player.upsert", ps.PlayerId, ps.PlayerName, matchDate); err != nil {
+		return err
+	}
+	_, err := w.s.Exec("player_name.upsert", ps.PlayerId, ps.PlayerName, matchDate)
+	return err
+}
+
+// GetPlayer resolves a player id to the player with their canonical name.
+func GetPlayer(db *sqlx.DB, playerId string) (*Player, error) {
+	p := Player{}
+	err := db.Get(&p, `SELECT id, name, first_seen, last_seen FROM player WHERE id = $1`, playerId)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// FindPlayers lists the players any of whose names contains name, ignoring case.
+func FindPlayers(db *sqlx.DB, name string) ([]Player, error) {
+	players := []Player{}
+	q := `SELECT id, name, first_seen, last_seen FROM player
+			WHERE id IN (SELECT player_id FROM player_name WHERE lower(name) LIKE lower($1))
+			ORDER BY name`
+	err := db.Select(&players, q, "%"+name+"%")
+	return players, err
+}
+
+// GetPlayerNames lists every name a player was seen under, oldest first.
+func GetPlayerNames(db *sqlx.DB, playerId string) ([]PlayerName, error) {
+	names := []PlayerName{}
+	q := `SELECT player_id, name, first_seen, last_seen FROM player_name WHERE player_id = $1 ORDER BY first_seen`
+	err := db.Select(&names, q, playerId)
+	return names, err
+}
+
+// GetPlayerAppearances lists the matches a player took part in, in chronological order.
+func GetPlayerAppearances(db *sqlx.DB, playerId string) ([]Appearance, error) {
+	appearances := []Appearance{}
+	q := `SELECT ps.id AS player_stats_id, m.id AS match_id, m.match_date, m.season, m.league_id, ps.team_name,
+				m.home_team_name, m.away_team_name, m.home_score, m.away_score, ps.is_substitute,
+				ps.minute_on, ps.minute_off, ps.sent_off,
+				(SELECT count(*) FROM player_event e WHERE e.player_stats_id = ps.id) AS events
+			FROM player_stats ps JOIN match m ON m.id = ps.match_id
+			WHERE ps.player_id = $1
+			ORDER BY m.match_date, m.id`
+	err := db.Select(&appearances, q, playerId)
+	return appearances, err
+}
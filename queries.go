@@ -0,0 +1,210 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"sync"
+)
+
+// queries are the statements the crawler runs, by name. Every value that comes from a crawled page is passed as a
+// bound parameter, never spliced into the SQL, so a team name or url with quotes in it is stored as it is.
+var queries = map[string]string{
+	"match.crawled":      `SELECT count(*) FROM match WHERE url = $1 AND is_crawled = $2`,
+	"match.uncrawled":    `SELECT * FROM match WHERE is_crawled = $1 ORDER BY match_date, id`,
+	"match.get":          `SELECT * FROM match WHERE id = $1`,
+	"match.mark_crawled": `UPDATE match SET is_crawled = $1 WHERE id = $2`,
+	// a match crawled from its url alone has no date, teams or score, so those of the stored row are kept
+	"match.upsert": `INSERT INTO match (id, season, match_date, match_time, league_id, home_team_name, away_team_name,
+				home_team_id, away_team_id, home_score, away_score, url, is_crawled)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			ON CONFLICT (id) DO UPDATE SET season = excluded.season,
+				match_date = COALESCE(excluded.match_date, match.match_date),
+				match_time = COALESCE(NULLIF(excluded.match_time, ''), match.match_time), league_id = excluded.league_id,
+				home_team_name = COALESCE(NULLIF(excluded.home_team_name, ''), match.home_team_name),
+				away_team_name = COALESCE(NULLIF(excluded.away_team_name, ''), match.away_team_name),
+				home_team_id = COALESCE(excluded.home_team_id, match.home_team_id),
+				away_team_id = COALESCE(excluded.away_team_id, match.away_team_id),
+				home_score = CASE WHEN excluded.match_date IS NULL THEN match.home_score ELSE excluded.home_score END,
+				away_score = CASE WHEN excluded.match_date IS NULL THEN match.away_score ELSE excluded.away_score END,
+				url = excluded.url, is_crawled = excluded.is_crawled`,
+
+	"player_stats.upsert": `INSERT INTO player_stats (match_id, team_name, team_id, player_id, player_name, is_substitute,
+				minute_on, minute_off, minutes_played, sent_off, url)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			ON CONFLICT (match_id, player_id) DO UPDATE SET
+				team_name = COALESCE(NULLIF(excluded.team_name, ''), player_stats.team_name),
+				team_id = COALESCE(excluded.team_id, player_stats.team_id),
+				player_name = excluded.player_name, is_substitute = excluded.is_substitute, minute_on = excluded.minute_on,
+				minute_off = excluded.minute_off, minutes_played = excluded.minutes_played, sent_off = excluded.sent_off,
+				url = excluded.url
+			RETURNING id`,
+	"player_stats.ids_by_match": `SELECT id FROM player_stats WHERE match_id = $1`,
+	"player_stats.delete":       `DELETE FROM player_stats WHERE id = $1`,
+
+	"player_event.upsert": `INSERT INTO player_event (player_stats_id, event_half, event_minute, event_type, raw_type, category, outcome, qualifiers,
+				x1, y1, x2, y2, pitch_x1, pitch_y1, pitch_x2, pitch_y2, ordinal)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+			ON CONFLICT (player_stats_id, event_half, event_minute, raw_type, x1, y1, x2, y2, ordinal) DO UPDATE SET
+				event_type = excluded.event_type, category = excluded.category, outcome = excluded.outcome,
+				qualifiers = excluded.qualifiers, pitch_x1 = excluded.pitch_x1, pitch_y1 = excluded.pitch_y1,
+				pitch_x2 = excluded.pitch_x2, pitch_y2 = excluded.pitch_y2
+			RETURNING id`,
+	"player_event.ids":          `SELECT id FROM player_event WHERE player_stats_id = $1`,
+	"player_event.delete":       `DELETE FROM player_event WHERE player_stats_id = $1`,
+	"player_event.delete_by_id": `DELETE FROM player_event WHERE id = $1`,
+
+	"player.upsert": `INSERT INTO player (id, name, first_seen, last_seen) VALUES ($1, $2, $3, $3)
+			ON CONFLICT (id) DO UPDATE SET
+				name = CASE WHEN player.last_seen IS NULL OR excluded.last_seen >= player.last_seen THEN excluded.name ELSE player.name END,
+				first_seen = CASE WHEN player.first_seen IS NULL OR excluded.first_seen < player.first_seen THEN excluded.first_seen ELSE player.first_seen END,
+				last_seen = CASE WHEN player.last_seen IS NULL OR excluded.last_seen > player.last_seen THEN excluded.last_seen ELSE player.last_seen END`,
+	"player_name.upsert": `INSERT INTO player_name (player_id, name, first_seen, last_seen) VALUES ($1, $2, $3, $3)
+			ON CONFLICT (player_id, name) DO UPDATE SET
+				first_seen = CASE WHEN player_name.first_seen IS NULL OR excluded.first_seen < player_name.first_seen THEN excluded.first_seen ELSE player_name.first_seen END,
+				last_seen = CASE WHEN player_name.last_seen IS NULL OR excluded.last_seen > player_name.last_seen THEN excluded.last_seen ELSE player_name.last_seen END`,
+
+	"team.by_alias":     `SELECT t.id, t.name FROM team t JOIN team_alias a ON a.team_id = t.id WHERE a.alias = $1`,
+	"team.by_name":      `SELECT id, name FROM team WHERE name = $1`,
+	"team.insert":       `INSERT INTO team (name) VALUES ($1) ON CONFLICT (name) DO NOTHING`,
+	"team_alias.insert": `INSERT INTO team_alias (alias, team_id) VALUES ($1, $2) ON CONFLICT (alias) DO NOTHING`,
+
+	"play_direction.upsert": `INSERT INTO play_direction (match_id, team_id, event_half, attacking_right) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (match_id, team_id, event_half) DO UPDATE SET attacking_right = excluded.attacking_right`,
+	"play_direction.by_team": `SELECT event_half, attacking_right FROM play_direction WHERE match_id = $1 AND team_id = $2`,
+
+	"crawl_failure.record": `INSERT INTO crawl_failure (url, stage, match_id, error, attempts, last_attempt) VALUES ($1, $2, $3, $4, 1, $5)
+			ON CONFLICT (url, stage) DO UPDATE SET error = excluded.error, attempts = crawl_failure.attempts + 1, last_attempt = excluded.last_attempt`,
+	"crawl_failure.resolve":        `DELETE FROM crawl_failure WHERE url = $1 AND stage = $2`,
+	"crawl_failure.list":           `SELECT * FROM crawl_failure WHERE $1 = 0 OR attempts < $1 ORDER BY id`,
+	"crawl_failure.count_by_match": `SELECT count(*) FROM crawl_failure WHERE match_id = $1`,
+}
+
+// Statements prepares the queries by name the first time they are used and keeps them for reuse. The statements of
+// a database are shared by all goroutines; Tx binds them to a transaction, reusing the ones already prepared on the
+// database and preparing the others on the transaction itself, as the pool may have no other connection to spare.
+type Statements struct {
+	db     *sqlx.DB
+	tx     *sqlx.Tx
+	parent *Statements
+
+	mu    sync.Mutex
+	stmts map[string]*sqlx.Stmt
+}
+
+// NewStatements returns the statements of db, none of which is prepared yet.
+func NewStatements(db *sqlx.DB) *Statements {
+	return &Statements{db: db, stmts: make(map[string]*sqlx.Stmt)}
+}
+
+// TxStatements returns statements prepared on tx alone, for transactions such as migrations that change the
+// tables the statements refer to.
+func TxStatements(tx *sqlx.Tx) *Statements {
+	return &Statements{tx: tx, stmts: make(map[string]*sqlx.Stmt)}
+}
+
+// Tx returns the statements of s bound to tx. They are closed with the transaction.
+func (s *Statements) Tx(tx *sqlx.Tx) *Statements {
+	return &Statements{db: s.db, tx: tx, parent: s, stmts: make(map[string]*sqlx.Stmt)}
+}
+
+// Begin starts a transaction on the database of s and returns it with the statements bound to it.
+func (s *Statements) Begin() (*sqlx.Tx, *Statements, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, nil, err
+	}
+	return tx, s.Tx(tx), nil
+}
+
+// Stmt returns the prepared statement of the query called name.
+func (s *Statements) Stmt(name string) (*sqlx.Stmt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stmt, ok := s.stmts[name]; ok {
+		return stmt, nil
+	}
+	q, ok := queries[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown query %q", name)
+	}
+
+	var stmt *sqlx.Stmt
+	var err error
+	switch {
+	case s.parent != nil:
+		if shared := s.parent.prepared(name); shared != nil {
+			stmt = s.tx.Stmtx(shared)
+		} else {
+			stmt, err = s.tx.Preparex(q)
+		}
+	case s.tx != nil:
+		stmt, err = s.tx.Preparex(q)
+	default:
+		stmt, err = s.db.Preparex(q)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query %s: %v", name, err)
+	}
+	s.stmts[name] = stmt
+	return stmt, nil
+}
+
+// prepared returns the statement of the query called name if it is prepared already, or nil.
+func (s *Statements) prepared(name string) *sqlx.Stmt {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stmts[name]
+}
+
+// PrepareAll prepares every query, so that transactions find all of them prepared. The tables they refer to have
+// to exist.
+func (s *Statements) PrepareAll() error {
+	for name, _ := range queries {
+		if _, err := s.Stmt(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Exec runs the query called name with args.
+func (s *Statements) Exec(name string, args ...interface{}) (sql.Result, error) {
+	stmt, err := s.Stmt(name)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Exec(args...)
+}
+
+// Get scans the single row returned by the query called name into dest.
+func (s *Statements) Get(dest interface{}, name string, args ...interface{}) error {
+	stmt, err := s.Stmt(name)
+	if err != nil {
+		return err
+	}
+	return stmt.Get(dest, args...)
+}
+
+// Select scans all rows returned by the query called name into the slice dest.
+func (s *Statements) Select(dest interface{}, name string, args ...interface{}) error {
+	stmt, err := s.Stmt(name)
+	if err != nil {
+		return err
+	}
+	return stmt.Select(dest, args...)
+}
+
+// Close closes the prepared statements of s.
+func (s *Statements) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	for name, stmt := range s.stmts {
+		if closeErr := stmt.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+		delete(s.stmts, name)
+	}
+	return err
+}
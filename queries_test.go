@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+)
+
+// TestSaveMatchHostileInput saves names and urls that would break queries built by concatenation, and reads them
+// back unchanged.
+func TestSaveMatchHostileInput(t *testing.T) {
+	store := newTestStore(t)
+	home := `O'Higgins "FC"; DROP TABLE match; --`
+	away := `Borussia M'gladbach -- ; "away"`
+	m, playerStatsArray := testMatch("900002", home, away, 11)
+	m.Url += `?q='; DELETE FROM player_stats; --`
+	names := []string{`N'Golo Kanté`, `"Bobby" Tables'); DROP TABLE player; --`, `a;b--c`}
+	for i, _ := range names {
+		playerStatsArray[i].PlayerName = names[i]
+		playerStatsArray[i].Url += `?p="'; --`
+	}
+	if err := store.SaveMatch(m, playerStatsArray, true); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := store.GetMatch(m.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.HomeTeamName != home || saved.AwayTeamName != away || saved.Url != m.Url {
+		t.Errorf("saved match %q - %q at %q, want %q - %q at %q", saved.HomeTeamName, saved.AwayTeamName, saved.Url,
+			home, away, m.Url)
+	}
+
+	db := store.DB()
+	var teams []string
+	if err := db.Select(&teams, `SELECT name FROM team ORDER BY id`); err != nil {
+		t.Fatal(err)
+	}
+	if len(teams) != 2 || teams[0] != home || teams[1] != away {
+		t.Errorf("teams %q, want %q and %q", teams, home, away)
+	}
+	for i, _ := range names {
+		ps := playerStatsArray[i]
+		var saved struct {
+			PlayerName string `db:"player_name"`
+			Url        string `db:"url"`
+		}
+		err := db.Get(&saved, `SELECT player_name, url FROM player_stats WHERE match_id = $1 AND player_id = $2`,
+			m.Id, ps.PlayerId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved.PlayerName != ps.PlayerName || saved.Url != ps.Url {
+			t.Errorf("player %s saved as %q at %q, want %q at %q", ps.PlayerId, saved.PlayerName, saved.Url,
+				ps.PlayerName, ps.Url)
+		}
+		var name string
+		if err := db.Get(&name, `SELECT name FROM player WHERE id = $1`, ps.PlayerId); err != nil {
+			t.Fatal(err)
+		}
+		if name != ps.PlayerName {
+			t.Errorf("player %s named %q, want %q", ps.PlayerId, name, ps.PlayerName)
+		}
+	}
+
+	var playerStats int
+	if err := db.Get(&playerStats, `SELECT count(*) FROM player_stats`); err != nil {
+		t.Fatal(err)
+	}
+	if playerStats != 22 {
+		t.Errorf("%d player stats, want 22", playerStats)
+	}
+}
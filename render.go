@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"fourfourtwo/pitch"
+	"github.com/jmoiron/sqlx"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SeasonEvent is an event of a player in normalized pitch coordinates.
+type SeasonEvent struct {
+	MatchId   string        `db:"match_id"`
+	EventType string        `db:"event_type"`
+	Category  EventCategory `db:"category"`
+	Outcome   EventOutcome  `db:"outcome"`
+	X1        float64       `db:"pitch_x1"`
+	Y1        float64       `db:"pitch_y1"`
+	X2        float64       `db:"pitch_x2"`
+	Y2        float64       `db:"pitch_y2"`
+}
+
+// GetPlayerSeasonEvents lists the events of a player in all matches of a season, in pitch coordinates.
+func GetPlayerSeasonEvents(db *sqlx.DB, playerId string, season int) ([]SeasonEvent, error) {
+	events := []SeasonEvent{}
+	q := `SELECT ps.match_id, e.event_type, e.category, e.outcome, e.pitch_x1, e.pitch_y1, e.pitch_x2, e.pitch_y2
+			FROM player_event e
+				JOIN player_stats ps ON ps.id = e.player_stats_id
+				JOIN match m ON m.id = ps.match_id
+			WHERE ps.player_id = $1 AND m.season = $2 AND e.pitch_x1 IS NOT NULL
+			ORDER BY m.match_date, e.id`
+	err := db.Select(&events, q, playerId, season)
+	return events, err
+}
+
+// CountPlayerSeasonMatches counts the matches a player took part in during a season.
+func CountPlayerSeasonMatches(db *sqlx.DB, playerId string, season int) (int, error) {
+	var count int
+	q := `SELECT count(DISTINCT ps.match_id) FROM player_stats ps JOIN match m ON m.id = ps.match_id
+			WHERE ps.player_id = $1 AND m.season = $2`
+	err := db.Get(&count, q, playerId, season)
+	return count, err
+}
+
+var fileNameReplacer = strings.NewReplacer(" ", "_", "/", "_")
+
+// RenderPlayerSeason plots the events of a player in a season on one pitch per event category, and writes the
+// image to dir as "<matches>-<player id>-<name>.<format>", format being png or svg. It returns the file written.
+func RenderPlayerSeason(db *sqlx.DB, playerId string, season int, dir, format string) (string, error) {
+	player, err := GetPlayer(db, playerId)
+	if err != nil {
+		return "", fmt.Errorf("player %s: %v", playerId, err)
+	}
+	matches, err := CountPlayerSeasonMatches(db, playerId, season)
+	if err != nil {
+		return "", err
+	}
+	events, err := GetPlayerSeasonEvents(db, playerId, season)
+	if err != nil {
+		return "", err
+	}
+
+	points := make([]pitch.Event, len(events))
+	for i, e := range events {
+		points[i] = pitch.Event{X: e.X1, Y: e.Y1, Facet: string(e.Category), Label: e.EventType}
+	}
+	title := fmt.Sprintf("%s, %d-%d (%d matches, %d events)", player.Name, season, season+1, matches, len(events))
+	plot := pitch.NewPlot(title, points)
+
+	name := fmt.Sprintf("%d-%s-%s.%s", matches, player.Id, fileNameReplacer.Replace(player.Name), format)
+	path := filepath.Join(dir, name)
+	return path, writeImage(path, format, plot)
+}
+
+// Statistics of a zone overlay.
+const (
+	ZoneCount   = "count"
+	ZoneSuccess = "success"
+	ZoneDensity = "density"
+)
+
+// RenderZones aggregates the events selected by filter into the zones of grid, as counts or success rates, or
+// into a kernel density heatmap with the given bandwidth in metres, and writes the overlay to path.
+func RenderZones(db *sqlx.DB, filter EventFilter, grid pitch.Grid, stat string, bandwidth float64, path, format string) error {
+	samples, err := GetEventSamples(db, filter)
+	if err != nil {
+		return err
+	}
+
+	subject := fmt.Sprintf("team %d", filter.TeamId)
+	if filter.PlayerId != "" {
+		subject = "player " + filter.PlayerId
+		if p, err := GetPlayer(db, filter.PlayerId); err == nil {
+			subject = p.Name
+		}
+	}
+	category := string(filter.Category)
+	if category == "" {
+		category = "all events"
+	}
+	title := fmt.Sprintf("%s, %d-%d, %s: %s of %d events", subject, filter.Season, filter.Season+1, category, stat, len(samples))
+
+	var overlay *pitch.Overlay
+	switch stat {
+	case ZoneCount:
+		overlay = pitch.NewZoneOverlay(title, grid, grid.Counts(samples), "%.0f")
+	case ZoneSuccess:
+		rates := grid.SuccessRates(samples)
+		for _, row := range rates {
+			for i, _ := range row {
+				row[i] *= 100
+			}
+		}
+		overlay = pitch.NewZoneOverlay(title, grid, rates, "%.0f%%")
+	case ZoneDensity:
+		overlay = pitch.NewDensityOverlay(title, pitch.Density(samples, bandwidth, 105, 68))
+	default:
+		return fmt.Errorf("unknown zone statistic %q", stat)
+	}
+	return writeImage(path, format, overlay)
+}
+
+// EventFilter selects the events of a player or a team in a season, optionally of one category only.
+type EventFilter struct {
+	PlayerId string
+	TeamId   int64
+	Season   int
+	Category EventCategory
+}
+
+// GetEventSamples returns the positions of the events selected by filter, in pitch coordinates, and whether each
+// of them succeeded: an outcome of success or goal.
+func GetEventSamples(db *sqlx.DB, filter EventFilter) ([]pitch.Sample, error) {
+	rows := []struct {
+		X       float64      `db:"pitch_x1"`
+		Y       float64      `db:"pitch_y1"`
+		Outcome EventOutcome `db:"outcome"`
+	}{}
+	q := `SELECT e.pitch_x1, e.pitch_y1, e.outcome
+			FROM player_event e
+				JOIN player_stats ps ON ps.id = e.player_stats_id
+				JOIN match m ON m.id = ps.match_id
+			WHERE m.season = $1 AND ($2 = '' OR ps.player_id = $2) AND ($3 = 0 OR ps.team_id = $3)
+				AND ($4 = '' OR e.category = $4) AND e.pitch_x1 IS NOT NULL`
+	if err := db.Select(&rows, q, filter.Season, filter.PlayerId, filter.TeamId, string(filter.Category)); err != nil {
+		return nil, err
+	}
+
+	samples := make([]pitch.Sample, len(rows))
+	for i, r := range rows {
+		samples[i] = pitch.Sample{X: r.X, Y: r.Y, Success: r.Outcome == OutcomeSuccess || r.Outcome == OutcomeGoal}
+	}
+	return samples, nil
+}
+
+// ParseGrid reads a grid given as "<columns>x<rows>", e.g. "6x4", or "18" for the Juego de Posición zones.
+func ParseGrid(s string) (pitch.Grid, error) {
+	if s == "18" {
+		return pitch.EighteenZones(), nil
+	}
+	var columns, rows int
+	if n, err := fmt.Sscanf(s, "%dx%d", &columns, &rows); err != nil || n != 2 || columns < 1 || rows < 1 {
+		return pitch.Grid{}, fmt.Errorf("bad grid %q, expected e.g. 6x4 or 18", s)
+	}
+	return pitch.NewGrid(columns, rows), nil
+}
+
+// writeImage writes something that renders itself as png or svg to path.
+func writeImage(path, format string, image interface {
+	WritePNG(w io.Writer) error
+	WriteSVG(w io.Writer) error
+}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	switch format {
+	case "png":
+		err = image.WritePNG(file)
+	case "svg":
+		err = image.WriteSVG(file)
+	default:
+		err = fmt.Errorf("unknown image format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"fourfourtwo/pitch"
+	"fourfourtwo/xg"
+	"github.com/jmoiron/sqlx"
+	"math"
+	"time"
+)
+
+// XGModel is a fitted expected goals model as stored in xg_model.
+type XGModel struct {
+	Id           int64   `db:"id"`
+	FittedAt     string  `db:"fitted_at"`
+	Shots        int     `db:"shots"`
+	Goals        int     `db:"goals"`
+	Intercept    float64 `db:"intercept"`
+	DistanceCoef float64 `db:"distance_coef"`
+	AngleCoef    float64 `db:"angle_coef"`
+}
+
+// Model returns the coefficients of the stored model.
+func (m *XGModel) Model() xg.Model {
+	return xg.Model{Intercept: m.Intercept, DistanceCoef: m.DistanceCoef, AngleCoef: m.AngleCoef}
+}
+
+// ErrNoXGModel is returned when shots are to be scored before any model was fitted.
+var ErrNoXGModel = errors.New(`no xG model fitted yet, run "shots fit" first`)
+
+// ShotEvent is a shot in pitch coordinates with its expected goals, nil if it was not scored by a model yet.
+type ShotEvent struct {
+	Id        int64        `db:"id"`
+	EventType string       `db:"event_type"`
+	Outcome   EventOutcome `db:"outcome"`
+	X1        float64      `db:"pitch_x1"`
+	Y1        float64      `db:"pitch_y1"`
+	XG        *float64     `db:"xg"`
+}
+
+// IsGoal tells whether the shot was scored.
+func (s ShotEvent) IsGoal() bool {
+	return s.Outcome == OutcomeGoal
+}
+
+func selectShots(tx *sqlx.Tx, onlyUnscored bool) ([]ShotEvent, error) {
+	shots := []ShotEvent{}
+	q := `SELECT id, event_type, outcome, pitch_x1, pitch_y1, xg FROM player_event
+			WHERE category = $1 AND pitch_x1 IS NOT NULL AND ($2 = 0 OR xg IS NULL)`
+	unscored := 0
+	if onlyUnscored {
+		unscored = 1
+	}
+	err := tx.Select(&shots, q, string(CategoryShot), unscored)
+	return shots, err
+}
+
+func scoreShots(tx *sqlx.Tx, model xg.Model, shots []ShotEvent) error {
+	stmt, err := tx.Preparex(`UPDATE player_event SET xg = $1 WHERE id = $2`)
+	if err != nil {
+		return err
+	}
+	for _, s := range shots {
+		if _, err := stmt.Exec(model.PredictAt(s.X1, s.Y1), s.Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FitXGModel fits an expected goals model on all stored shots, keeps it in xg_model and scores every shot with it.
+func FitXGModel(db *sqlx.DB) (*XGModel, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	shots, err := selectShots(tx, false)
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]xg.Shot, len(shots))
+	goals := 0
+	for i, s := range shots {
+		samples[i] = xg.NewShot(s.X1, s.Y1, s.IsGoal())
+		if s.IsGoal() {
+			goals++
+		}
+	}
+	model, err := xg.Fit(samples)
+	if err != nil {
+		return nil, fmt.Errorf("%d shots, %d goals: %v", len(shots), goals, err)
+	}
+
+	stored := &XGModel{
+		FittedAt:     time.Now().UTC().Format("2006-01-02 15:04:05"),
+		Shots:        len(shots),
+		Goals:        goals,
+		Intercept:    model.Intercept,
+		DistanceCoef: model.DistanceCoef,
+		AngleCoef:    model.AngleCoef}
+	q := `INSERT INTO xg_model (fitted_at, shots, goals, intercept, distance_coef, angle_coef) VALUES ($1, $2, $3, $4, $5, $6)`
+	if _, err := tx.Exec(q, stored.FittedAt, stored.Shots, stored.Goals, stored.Intercept, stored.DistanceCoef, stored.AngleCoef); err != nil {
+		return nil, err
+	}
+	if err := scoreShots(tx, model, shots); err != nil {
+		return nil, err
+	}
+	return stored, tx.Commit()
+}
+
+// GetXGModel returns the model fitted last, or ErrNoXGModel.
+func GetXGModel(db *sqlx.DB) (*XGModel, error) {
+	models := []XGModel{}
+	if err := db.Select(&models, `SELECT * FROM xg_model ORDER BY id DESC LIMIT 1`); err != nil {
+		return nil, err
+	}
+	if len(models) == 0 {
+		return nil, ErrNoXGModel
+	}
+	return &models[0], nil
+}
+
+// ScoreNewShots scores the shots crawled since the last model was fitted with that model, and returns their number.
+func ScoreNewShots(db *sqlx.DB) (int, error) {
+	stored, err := GetXGModel(db)
+	if err != nil {
+		return 0, err
+	}
+	tx, err := db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	shots, err := selectShots(tx, true)
+	if err != nil {
+		return 0, err
+	}
+	if err := scoreShots(tx, stored.Model(), shots); err != nil {
+		return 0, err
+	}
+	return len(shots), tx.Commit()
+}
+
+// XGTotal is the number of shots, goals and expected goals of a player or a team, in one match or in a season.
+type XGTotal struct {
+	Id        string     `db:"id"`
+	Name      string     `db:"name"`
+	MatchId   string     `db:"match_id"`
+	MatchDate *time.Time `db:"match_date"`
+	Shots     int        `db:"shots"`
+	Goals     int        `db:"goals"`
+	XG        float64    `db:"xg"`
+}
+
+// GetXGTotals sums the shots selected by filter per player, or per team if byTeam is set, and per match if
+// perMatch is set or else over the season. Shots not scored by a model count as 0 expected goals.
+func GetXGTotals(db *sqlx.DB, filter EventFilter, byTeam, perMatch bool) ([]XGTotal, error) {
+	subject := `ps.player_id AS id, max(coalesce(p.name, ps.player_name)) AS name`
+	groupBy := `ps.player_id`
+	if byTeam {
+		subject = `CAST(ps.team_id AS varchar(16)) AS id, max(coalesce(t.name, ps.team_name)) AS name`
+		groupBy = `ps.team_id`
+	}
+	match := `'' AS match_id, NULL AS match_date`
+	orderBy := `xg DESC`
+	if perMatch {
+		match = `m.id AS match_id, m.match_date`
+		orderBy = groupBy + `, m.match_date`
+		groupBy += `, m.id, m.match_date`
+	}
+
+	totals := []XGTotal{}
+	q := `SELECT ` + subject + `, ` + match + `, count(*) AS shots,
+				sum(CASE WHEN e.outcome = $1 THEN 1 ELSE 0 END) AS goals, coalesce(sum(e.xg), 0) AS xg
+			FROM player_event e
+				JOIN player_stats ps ON ps.id = e.player_stats_id
+				JOIN match m ON m.id = ps.match_id
+				LEFT JOIN player p ON p.id = ps.player_id
+				LEFT JOIN team t ON t.id = ps.team_id
+			WHERE e.category = $2 AND m.season = $3 AND ($4 = '' OR ps.player_id = $4) AND ($5 = 0 OR ps.team_id = $5)
+			GROUP BY ` + groupBy + `
+			ORDER BY ` + orderBy
+	err := db.Select(&totals, q, string(OutcomeGoal), string(CategoryShot), filter.Season, filter.PlayerId, filter.TeamId)
+	return totals, err
+}
+
+// GetShotEvents lists the shots of the player or team of filter in a season.
+func GetShotEvents(db *sqlx.DB, filter EventFilter) ([]ShotEvent, error) {
+	shots := []ShotEvent{}
+	q := `SELECT e.id, e.event_type, e.outcome, e.pitch_x1, e.pitch_y1, e.xg
+			FROM player_event e
+				JOIN player_stats ps ON ps.id = e.player_stats_id
+				JOIN match m ON m.id = ps.match_id
+			WHERE e.category = $1 AND m.season = $2 AND ($3 = '' OR ps.player_id = $3) AND ($4 = 0 OR ps.team_id = $4)
+				AND e.pitch_x1 IS NOT NULL
+			ORDER BY m.match_date, e.id`
+	err := db.Select(&shots, q, string(CategoryShot), filter.Season, filter.PlayerId, filter.TeamId)
+	return shots, err
+}
+
+// RenderShotMap plots the shots selected by filter, coloured by type, with the area of every marker proportional
+// to its expected goals, and writes the image to path.
+func RenderShotMap(db *sqlx.DB, filter EventFilter, path, format string) error {
+	shots, err := GetShotEvents(db, filter)
+	if err != nil {
+		return err
+	}
+
+	subject := fmt.Sprintf("team %d", filter.TeamId)
+	if filter.PlayerId != "" {
+		subject = "player " + filter.PlayerId
+		if p, err := GetPlayer(db, filter.PlayerId); err == nil {
+			subject = p.Name
+		}
+	}
+	var goals int
+	var total float64
+	points := make([]pitch.Event, len(shots))
+	for i, s := range shots {
+		points[i] = pitch.Event{X: s.X1, Y: s.Y1, Facet: "shots", Label: s.EventType, Radius: 0.5}
+		if s.XG != nil {
+			total += *s.XG
+			points[i].Radius = math.Max(0.5, 4*math.Sqrt(*s.XG))
+		}
+		if s.IsGoal() {
+			goals++
+		}
+	}
+	title := fmt.Sprintf("%s, %d-%d: %d shots, %d goals, %.2f xG", subject, filter.Season, filter.Season+1, len(shots), goals, total)
+	plot := pitch.NewPlot(title, points)
+	plot.Scale = 8
+	return writeImage(path, format, plot)
+}
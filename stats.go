@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Count is the number of events of one event type or category, how many of them succeeded (an outcome of success
+// or goal), and the count per 90 minutes played.
+type Count struct {
+	Name        string  `json:"name"`
+	Count       int     `json:"count"`
+	Successes   int     `json:"successes"`
+	SuccessRate float64 `json:"success_rate"`
+	Per90       float64 `json:"per_90"`
+}
+
+// MatchStats are the events of a player in one match.
+type MatchStats struct {
+	MatchId      string     `json:"match_id"`
+	MatchDate    *time.Time `json:"match_date"`
+	TeamName     string     `json:"team_name"`
+	IsSubstitute bool       `json:"is_substitute"`
+	Minutes      int        `json:"minutes"`
+	Types        []Count    `json:"types"`
+	Categories   []Count    `json:"categories"`
+}
+
+// PlayerSeasonStats are the events of a player in a season, by event type and by category, in total and per match.
+type PlayerSeasonStats struct {
+	PlayerId   string       `json:"player_id"`
+	Name       string       `json:"name"`
+	Season     int          `json:"season"`
+	Matches    int          `json:"matches"`
+	Minutes    int          `json:"minutes"`
+	Types      []Count      `json:"types"`
+	Categories []Count      `json:"categories"`
+	PerMatch   []MatchStats `json:"per_match,omitempty"`
+}
+
+// counter accumulates events into Counts by name.
+type counter map[string]*Count
+
+func (c counter) add(name string, count, successes int) {
+	if c[name] == nil {
+		c[name] = &Count{Name: name}
+	}
+	c[name].Count += count
+	c[name].Successes += successes
+}
+
+// counts returns the counts sorted by name, with their success rates and values per 90 of minutes.
+func (c counter) counts(minutes int) []Count {
+	counts := make([]Count, 0, len(c))
+	for _, count := range c {
+		if count.Count > 0 {
+			count.SuccessRate = float64(count.Successes) / float64(count.Count)
+		}
+		if minutes > 0 {
+			count.Per90 = float64(count.Count) * 90 / float64(minutes)
+		}
+		counts = append(counts, *count)
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Name < counts[j].Name })
+	return counts
+}
+
+// estimatedMinutes is the time a player was on the pitch in a match crawled before substitution minutes were
+// stored: the whole match for starters, and from the minute of their first event for substitutes.
+func estimatedMinutes(isSubstitute bool, firstEventMinute *int) int {
+	if !isSubstitute {
+		return MatchLength
+	}
+	if firstEventMinute == nil || *firstEventMinute >= MatchLength {
+		return 0
+	}
+	return MatchLength - *firstEventMinute
+}
+
+// GetPlayerSeasonStats aggregates the events of a player in a season.
+func GetPlayerSeasonStats(db *sqlx.DB, playerId string, season int) (*PlayerSeasonStats, error) {
+	player, err := GetPlayer(db, playerId)
+	if err != nil {
+		return nil, fmt.Errorf("player %s: %v", playerId, err)
+	}
+
+	matches := []struct {
+		PlayerStatsId    int64      `db:"player_stats_id"`
+		MatchId          string     `db:"match_id"`
+		MatchDate        *time.Time `db:"match_date"`
+		TeamName         string     `db:"team_name"`
+		IsSubstitute     bool       `db:"is_substitute"`
+		MinutesPlayed    *int       `db:"minutes_played"`
+		FirstEventMinute *int       `db:"first_event_minute"`
+	}{}
+	mq := `SELECT ps.id AS player_stats_id, m.id AS match_id, m.match_date, ps.team_name, ps.is_substitute, ps.minutes_played,
+				(SELECT min(e.event_minute) FROM player_event e WHERE e.player_stats_id = ps.id) AS first_event_minute
+			FROM player_stats ps JOIN match m ON m.id = ps.match_id
+			WHERE ps.player_id = $1 AND m.season = $2
+			ORDER BY m.match_date, m.id`
+	if err := db.Select(&matches, mq, playerId, season); err != nil {
+		return nil, err
+	}
+
+	events := []struct {
+		PlayerStatsId int64         `db:"player_stats_id"`
+		EventType     string        `db:"event_type"`
+		Category      EventCategory `db:"category"`
+		Count         int           `db:"count"`
+		Successes     int           `db:"successes"`
+	}{}
+	eq := `SELECT e.player_stats_id, e.event_type, coalesce(e.category, '') AS category, count(*) AS count,
+				sum(CASE WHEN e.outcome IN ($1, $2) THEN 1 ELSE 0 END) AS successes
+			FROM player_event e
+				JOIN player_stats ps ON ps.id = e.player_stats_id
+				JOIN match m ON m.id = ps.match_id
+			WHERE ps.player_id = $3 AND m.season = $4
+			GROUP BY e.player_stats_id, e.event_type, e.category`
+	if err := db.Select(&events, eq, string(OutcomeSuccess), string(OutcomeGoal), playerId, season); err != nil {
+		return nil, err
+	}
+
+	stats := &PlayerSeasonStats{PlayerId: player.Id, Name: player.Name, Season: season, Matches: len(matches)}
+	seasonTypes, seasonCategories := make(counter), make(counter)
+	for _, m := range matches {
+		types, categories := make(counter), make(counter)
+		for _, e := range events {
+			if e.PlayerStatsId != m.PlayerStatsId {
+				continue
+			}
+			types.add(e.EventType, e.Count, e.Successes)
+			categories.add(string(e.Category), e.Count, e.Successes)
+			seasonTypes.add(e.EventType, e.Count, e.Successes)
+			seasonCategories.add(string(e.Category), e.Count, e.Successes)
+		}
+
+		var minutes int
+		if m.MinutesPlayed != nil {
+			minutes = *m.MinutesPlayed
+		} else {
+			minutes = estimatedMinutes(m.IsSubstitute, m.FirstEventMinute)
+		}
+		stats.Minutes += minutes
+		stats.PerMatch = append(stats.PerMatch, MatchStats{
+			MatchId:      m.MatchId,
+			MatchDate:    m.MatchDate,
+			TeamName:     m.TeamName,
+			IsSubstitute: m.IsSubstitute,
+			Minutes:      minutes,
+			Types:        types.counts(minutes),
+			Categories:   categories.counts(minutes)})
+	}
+	stats.Types = seasonTypes.counts(stats.Minutes)
+	stats.Categories = seasonCategories.counts(stats.Minutes)
+	return stats, nil
+}
+
+// WriteTable writes the season totals as a text table, followed by one line per match if perMatch is set.
+func (s *PlayerSeasonStats) WriteTable(w io.Writer, perMatch bool) error {
+	fmt.Fprintf(w, "%s (%s), %d-%d: %d matches, %d minutes\n", s.Name, s.PlayerId, s.Season, s.Season+1, s.Matches, s.Minutes)
+	for _, group := range []struct {
+		title  string
+		counts []Count
+	}{{"category", s.Categories}, {"event type", s.Types}} {
+		fmt.Fprintf(w, "\n%-24s  %6s  %9s  %6s  %6s\n", group.title, "count", "successes", "rate", "per 90")
+		for _, c := range group.counts {
+			fmt.Fprintf(w, "%-24s  %6d  %9d  %5.0f%%  %6.2f\n", c.Name, c.Count, c.Successes, 100*c.SuccessRate, c.Per90)
+		}
+	}
+	if !perMatch {
+		return nil
+	}
+
+	fmt.Fprintf(w, "\n%-10s  %-8s  %-24s  %3s  %7s  %s\n", "date", "match", "team", "sub", "minutes", "events")
+	for _, m := range s.PerMatch {
+		sub := ""
+		if m.IsSubstitute {
+			sub = "yes"
+		}
+		var total int
+		for _, c := range m.Categories {
+			total += c.Count
+		}
+		_, err := fmt.Fprintf(w, "%-10s  %-8s  %-24s  %3s  %7d  %d\n", formatDate(m.MatchDate), m.MatchId, m.TeamName, sub, m.Minutes, total)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteCSV writes one row per event type, of the season or of every match if perMatch is set.
+func (s *PlayerSeasonStats) WriteCSV(w io.Writer, perMatch bool) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"player_id", "name", "season", "match_id", "match_date", "minutes", "event_type", "count", "successes", "success_rate", "per_90"})
+	row := func(matchId, matchDate string, minutes int, c Count) {
+		out.Write([]string{s.PlayerId, s.Name, strconv.Itoa(s.Season), matchId, matchDate, strconv.Itoa(minutes), c.Name,
+			strconv.Itoa(c.Count), strconv.Itoa(c.Successes), strconv.FormatFloat(c.SuccessRate, 'f', 4, 64),
+			strconv.FormatFloat(c.Per90, 'f', 4, 64)})
+	}
+	if perMatch {
+		for _, m := range s.PerMatch {
+			date := ""
+			if m.MatchDate != nil {
+				date = m.MatchDate.Format("2006-01-02")
+			}
+			for _, c := range m.Types {
+				row(m.MatchId, date, m.Minutes, c)
+			}
+		}
+	} else {
+		for _, c := range s.Types {
+			row("", "", s.Minutes, c)
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// WriteJSON writes the stats as an indented json document, without the per match breakdown unless perMatch is set.
+func (s *PlayerSeasonStats) WriteJSON(w io.Writer, perMatch bool) error {
+	doc := *s
+	if !perMatch {
+		doc.PerMatch = nil
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testSaveAndRead saves a match twice and checks what the read queries return, on any backend.
+func testSaveAndRead(t *testing.T, store Store) {
+	m, playerStatsArray := testMatch("900001", "Arsenal", "Liverpool", 11)
+	for i := 0; i < 2; i++ {
+		if err := store.SaveMatch(m, playerStatsArray, true); err != nil {
+			t.Fatalf("save %d: %v", i+1, err)
+		}
+	}
+
+	crawled, err := store.IsMatchCrawled(m)
+	if err != nil || !crawled {
+		t.Fatalf("IsMatchCrawled = %v, %v, want true", crawled, err)
+	}
+	saved, err := store.GetMatch(m.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.HomeTeamName != "Arsenal" || saved.AwayTeamName != "Liverpool" || saved.HomeTeamId == nil || saved.AwayTeamId == nil {
+		t.Errorf("saved match %+v, want both teams with ids", saved)
+	}
+	uncrawled, err := store.ListUncrawled()
+	if err != nil || len(uncrawled) != 0 {
+		t.Errorf("ListUncrawled = %v, %v, want none", uncrawled, err)
+	}
+
+	db := store.DB()
+	var playerStats, events int
+	if err := db.Get(&playerStats, `SELECT count(*) FROM player_stats WHERE match_id = $1`, m.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Get(&events, `SELECT count(*) FROM player_event`); err != nil {
+		t.Fatal(err)
+	}
+	if playerStats != 22 || events != 44 {
+		t.Errorf("saved twice: %d player stats and %d events, want 22 and 44", playerStats, events)
+	}
+
+	playerId := playerStatsArray[0].PlayerId
+	appearances, err := GetPlayerAppearances(db, playerId)
+	if err != nil || len(appearances) != 1 {
+		t.Errorf("GetPlayerAppearances = %v, %v, want one", appearances, err)
+	}
+	teams, err := ListTeams(db)
+	if err != nil || len(teams) != 2 {
+		t.Errorf("ListTeams = %v, %v, want two", teams, err)
+	}
+	stats, err := GetPlayerSeasonStats(db, playerId, 2016)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Matches != 1 || len(stats.Types) != 1 || stats.Types[0].Count != 2 {
+		t.Errorf("GetPlayerSeasonStats = %+v, want 2 passes in 1 match", stats)
+	}
+	if _, err := GetXGTotals(db, EventFilter{Season: 2016}, true, false); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSQLiteStore(t *testing.T) {
+	testSaveAndRead(t, newTestStore(t))
+}
+
+// newPostgresTestStore opens a migrated store in a schema of its own of the PostgreSQL database of
+// FOURFOURTWO_TEST_PG_DSN, e.g. "postgres://postgres@localhost/postgres?sslmode=disable", dropped when the test
+// ends. The test is skipped if the variable is not set.
+func newPostgresTestStore(t *testing.T) Store {
+	t.Helper()
+	dsn := os.Getenv("FOURFOURTWO_TEST_PG_DSN")
+	if dsn == "" {
+		t.Skip("FOURFOURTWO_TEST_PG_DSN is not set")
+	}
+
+	admin, err := sqlx.Connect(string(Postgres), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("fourfourtwo_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		admin.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`)
+		admin.Close()
+	})
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+
+	store, err := OpenStore(u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// registered after the cleanup that drops the schema, so the store is closed first
+	t.Cleanup(func() { store.Close() })
+	if _, err := store.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestPostgresStore(t *testing.T) {
+	testSaveAndRead(t, newPostgresTestStore(t))
+}
+
+// TestPostgresConcurrentTeams resolves a new team in two transactions at once, as two crawlers sharing the
+// database do.
+func TestPostgresConcurrentTeams(t *testing.T) {
+	s := NewStatements(newPostgresTestStore(t).DB())
+	defer s.Close()
+
+	tx1, ts1, err := s.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx1.Rollback()
+	first, err := newTeamResolver(ts1).Resolve("Sutton United")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second := make(chan error)
+	go func() {
+		tx2, ts2, err := s.Begin()
+		if err != nil {
+			second <- err
+			return
+		}
+		defer tx2.Rollback()
+		team, err := newTeamResolver(ts2).Resolve("Sutton United")
+		if err == nil && team.Id != first.Id {
+			err = fmt.Errorf("second crawler got team %d, want %d", team.Id, first.Id)
+		}
+		if err == nil {
+			err = tx2.Commit()
+		}
+		second <- err
+	}()
+
+	// the second transaction waits for the first one's team and alias
+	time.Sleep(100 * time.Millisecond)
+	if err := tx1.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-second; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSaveMatchFromUrlKeepsStoredMatch(t *testing.T) {
+	store := newTestStore(t)
+	m, playerStatsArray := testMatch("900003", "Arsenal", "Liverpool", 11)
+	if err := store.SaveMatch(m, playerStatsArray, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// crawl match --url without the stored row: no date, teams or score
+	recrawl := NewMatchFromUrl(m.Url)
+	_, playerStatsArray = testMatch("900003", "", "", 11)
+	if err := store.SaveMatch(&recrawl, playerStatsArray, true); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := store.GetMatch(m.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.MatchDate == nil || saved.MatchTime != "15:00" || saved.HomeTeamName != "Arsenal" ||
+		saved.AwayTeamName != "Liverpool" || saved.HomeTeamId == nil || saved.AwayTeamId == nil ||
+		saved.HomeScore != 2 || saved.AwayScore != 1 {
+		t.Errorf("crawling again from the url left %+v", saved)
+	}
+	var withoutTeam int
+	if err := store.DB().Get(&withoutTeam, `SELECT count(*) FROM player_stats WHERE team_id IS NULL`); err != nil {
+		t.Fatal(err)
+	}
+	if withoutTeam != 0 {
+		t.Errorf("%d player stats lost their team", withoutTeam)
+	}
+}
+
+func TestRemappedEventsKeepTheirRows(t *testing.T) {
+	store := newTestStore(t)
+	m, playerStatsArray := testMatch("900004", "Arsenal", "Liverpool", 11)
+	// an unmapped marker drawn on top of a pass
+	events := *playerStatsArray[0].Events
+	events = append(events, events[0])
+	events[2].RawType, events[2].EventType = "smallpurple", UnknownEventType
+	*playerStatsArray[0].Events = events
+	if err := store.SaveMatch(m, playerStatsArray, true); err != nil {
+		t.Fatal(err)
+	}
+	db := store.DB()
+	ids := []int64{}
+	if err := db.Select(&ids, `SELECT id FROM player_event ORDER BY id`); err != nil {
+		t.Fatal(err)
+	}
+
+	EventTypeMap["smallpurple"] = "pass_success"
+	defer delete(EventTypeMap, "smallpurple")
+	if _, err := RemapEventTypes(db); err != nil {
+		t.Fatalf("remapping onto the type of an identical event: %v", err)
+	}
+
+	// crawled again with the new type
+	events[2].EventType = "pass_success"
+	if err := store.SaveMatch(m, playerStatsArray, true); err != nil {
+		t.Fatal(err)
+	}
+	after := []int64{}
+	if err := db.Select(&after, `SELECT id FROM player_event ORDER BY id`); err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(ids) || after[0] != ids[0] || after[len(after)-1] != ids[len(ids)-1] {
+		t.Errorf("events saved again with another type got ids %v, want %v", after, ids)
+	}
+}
+
+func TestOpenExistingStoreDoesNotCreateDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.db")
+	if store, err := OpenExistingStore(path); err == nil {
+		store.Close()
+		t.Error("opened a database that does not exist")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("%s was created", path)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strings"
+)
+
+// EventCategory is the kind of action an event is, e.g. a pass or a shot.
+type EventCategory string
+
+const (
+	CategoryPass      EventCategory = "pass"
+	CategoryShot      EventCategory = "shot"
+	CategoryTakeOn    EventCategory = "take_on"
+	CategoryAerial    EventCategory = "aerial"
+	CategoryFoul      EventCategory = "foul"
+	CategoryError     EventCategory = "error"
+	CategoryDefensive EventCategory = "defensive"
+	CategoryUnknown   EventCategory = "unknown"
+)
+
+// EventOutcome is how an event turned out for the player's team.
+type EventOutcome string
+
+const (
+	OutcomeSuccess EventOutcome = "success"
+	OutcomeFail    EventOutcome = "fail"
+	OutcomeGoal    EventOutcome = "goal"
+	OutcomeBlocked EventOutcome = "blocked"
+	OutcomeNone    EventOutcome = ""
+)
+
+// Qualifiers give the details of an event within its category.
+const (
+	QualifierAssist        = "assist"
+	QualifierChanceCreated = "chance_created"
+	QualifierOnTarget      = "on_target"
+	QualifierOffTarget     = "off_target"
+	QualifierCommitted     = "committed"
+	QualifierSuffered      = "suffered"
+	QualifierLeadingToGoal = "leading_to_goal"
+	QualifierLeadingToShot = "leading_to_shot"
+	QualifierTackle        = "tackle"
+	QualifierClearance     = "clearance"
+	QualifierInterception  = "interception"
+	QualifierBallRecovery  = "ball_recovery"
+	QualifierShotBlock     = "shot_block"
+	QualifierCrossBlock    = "cross_block"
+)
+
+// EventClass places an event type in the taxonomy.
+type EventClass struct {
+	Category   EventCategory `json:"category"`
+	Outcome    EventOutcome  `json:"outcome"`
+	Qualifiers []string      `json:"qualifiers"`
+}
+
+// EventTaxonomy classifies the event types of EventTypeMap. Types added with LoadEventTypeMap can be classified
+// in the same file.
+var EventTaxonomy = map[string]EventClass{
+	"pass_success":          {CategoryPass, OutcomeSuccess, nil},
+	"pass_fail":             {CategoryPass, OutcomeFail, nil},
+	"pass_goal_assist":      {CategoryPass, OutcomeSuccess, []string{QualifierAssist}},
+	"pass_chance_created":   {CategoryPass, OutcomeSuccess, []string{QualifierChanceCreated}},
+	"shot_on_target":        {CategoryShot, OutcomeSuccess, []string{QualifierOnTarget}},
+	"shot_off_target":       {CategoryShot, OutcomeFail, []string{QualifierOffTarget}},
+	"shot_goal":             {CategoryShot, OutcomeGoal, []string{QualifierOnTarget}},
+	"shot_blocked":          {CategoryShot, OutcomeBlocked, nil},
+	"take_on_success":       {CategoryTakeOn, OutcomeSuccess, nil},
+	"take_on_fail":          {CategoryTakeOn, OutcomeFail, nil},
+	"aerial_duel_won":       {CategoryAerial, OutcomeSuccess, nil},
+	"aerial_duel_lost":      {CategoryAerial, OutcomeFail, nil},
+	"foul_commited":         {CategoryFoul, OutcomeFail, []string{QualifierCommitted}},
+	"foul_suffered":         {CategoryFoul, OutcomeSuccess, []string{QualifierSuffered}},
+	"error_leading_goal":    {CategoryError, OutcomeFail, []string{QualifierLeadingToGoal}},
+	"error_leading_shot":    {CategoryError, OutcomeFail, []string{QualifierLeadingToShot}},
+	"def_tackle_success":    {CategoryDefensive, OutcomeSuccess, []string{QualifierTackle}},
+	"def_tackle_fail":       {CategoryDefensive, OutcomeFail, []string{QualifierTackle}},
+	"def_clearance_success": {CategoryDefensive, OutcomeSuccess, []string{QualifierClearance}},
+	"def_clearance_fail":    {CategoryDefensive, OutcomeFail, []string{QualifierClearance}},
+	"def_interception":      {CategoryDefensive, OutcomeSuccess, []string{QualifierInterception}},
+	"def_ball_recovery":     {CategoryDefensive, OutcomeSuccess, []string{QualifierBallRecovery}},
+	"def_block_shot":        {CategoryDefensive, OutcomeSuccess, []string{QualifierShotBlock}},
+	"def_block_cross":       {CategoryDefensive, OutcomeSuccess, []string{QualifierCrossBlock}}}
+
+// ClassifyEventType returns the class of an event type, CategoryUnknown with no outcome if it is not in
+// EventTaxonomy.
+func ClassifyEventType(eventType string) EventClass {
+	if class, ok := EventTaxonomy[eventType]; ok {
+		return class
+	}
+	return EventClass{Category: CategoryUnknown, Outcome: OutcomeNone}
+}
+
+// Classify sets the category, outcome and qualifiers of e from its event type.
+func (e *PlayerEvent) Classify() {
+	class := ClassifyEventType(e.EventType)
+	e.Category, e.Outcome, e.Qualifiers = class.Category, class.Outcome, class.Qualifiers
+}
+
+// HasQualifier tells whether the event has qualifier q.
+func (e *PlayerEvent) HasQualifier(q string) bool {
+	for _, qualifier := range e.Qualifiers {
+		if qualifier == q {
+			return true
+		}
+	}
+	return false
+}
+
+// JoinQualifiers gives the qualifiers as stored in the qualifiers column: comma separated, with a leading and a
+// trailing comma so a single qualifier can be matched with LIKE '%,assist,%'.
+func JoinQualifiers(qualifiers []string) string {
+	if len(qualifiers) == 0 {
+		return ""
+	}
+	return "," + strings.Join(qualifiers, ",") + ","
+}
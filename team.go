@@ -0,0 +1,228 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"regexp"
+	"strings"
+)
+
+// Team is a club with a stable id. The names a team is listed under on the site are kept in team_alias, so
+// "Man Utd" and "Manchester United" can point to the same team once they are merged.
+type Team struct {
+	Id   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+// TeamSummary is a team together with its aliases and the number of matches it played.
+type TeamSummary struct {
+	Team
+	Aliases []string
+	Matches int64 `db:"matches"`
+}
+
+// NormalizeTeamName drops leading, trailing and repeated whitespace from a team name as scraped.
+func NormalizeTeamName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// teamResolver maps team names to team ids within a transaction, adding a team for every name not seen before.
+type teamResolver struct {
+	s     *Statements
+	teams map[string]Team
+}
+
+func newTeamResolver(s *Statements) *teamResolver {
+	return &teamResolver{s: s, teams: make(map[string]Team)}
+}
+
+// Resolve returns the team listed as name, or nil for an empty name. Several crawlers sharing a database may add
+// the same team at once; both inserts tolerate the other one and read back the row that was saved.
+func (r *teamResolver) Resolve(name string) (*Team, error) {
+	name = NormalizeTeamName(name)
+	if name == "" {
+		return nil, nil
+	}
+	if t, ok := r.teams[name]; ok {
+		return &t, nil
+	}
+
+	t := Team{}
+	err := r.s.Get(&t, "team.by_alias", name)
+	if err == sql.ErrNoRows {
+		if _, err := r.s.Exec("team.insert", name); err != nil {
+			return nil, err
+		}
+		if err := r.s.Get(&t, "team.by_name", name); err != nil {
+			return nil, err
+		}
+		if _, err := r.s.Exec("team_alias.insert", name, t.Id); err != nil {
+			return nil, err
+		}
+		// another crawler may have added the alias in the meantime, the one that was first wins
+		if err := r.s.Get(&t, "team.by_alias", name); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	r.teams[name] = t
+	return &t, nil
+}
+
+// resolveMatchTeams sets the team ids of a match and its players, replacing the team names with the canonical ones.
+func resolveMatchTeams(r *teamResolver, m *Match, playerStatsArray []*PlayerStats) error {
+	home, err := r.Resolve(m.HomeTeamName)
+	if err != nil {
+		return err
+	}
+	away, err := r.Resolve(m.AwayTeamName)
+	if err != nil {
+		return err
+	}
+	if home != nil {
+		m.HomeTeamId, m.HomeTeamName = &home.Id, home.Name
+	}
+	if away != nil {
+		m.AwayTeamId, m.AwayTeamName = &away.Id, away.Name
+	}
+
+	for _, ps := range playerStatsArray {
+		if err := resolvePlayerStatsTeam(r, ps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func resolvePlayerStatsTeam(r *teamResolver, ps *PlayerStats) error {
+	t, err := r.Resolve(ps.TeamName)
+	if err != nil {
+		return err
+	}
+	if t != nil {
+		ps.TeamId, ps.TeamName = &t.Id, t.Name
+	}
+	return nil
+}
+
+// ListTeams returns all teams with their aliases and number of matches, ordered by name.
+func ListTeams(db *sqlx.DB) ([]TeamSummary, error) {
+	teams := []TeamSummary{}
+	q := `SELECT t.id, t.name, (SELECT count(*) FROM match m WHERE m.home_team_id = t.id OR m.away_team_id = t.id) AS matches
+			FROM team t ORDER BY t.name`
+	if err := db.Select(&teams, q); err != nil {
+		return nil, err
+	}
+
+	aliases := []struct {
+		Alias  string `db:"alias"`
+		TeamId int64  `db:"team_id"`
+	}{}
+	if err := db.Select(&aliases, `SELECT alias, team_id FROM team_alias ORDER BY alias`); err != nil {
+		return nil, err
+	}
+	index := make(map[int64]int)
+	for i, _ := range teams {
+		index[teams[i].Id] = i
+	}
+	for _, a := range aliases {
+		if i, ok := index[a.TeamId]; ok && a.Alias != teams[i].Name {
+			teams[i].Aliases = append(teams[i].Aliases, a.Alias)
+		}
+	}
+	return teams, nil
+}
+
+var teamNameSeparatorRe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// teamNameTokens splits a team name into lower case words, spelling out common abbreviations and dropping
+// club suffixes that the site uses inconsistently.
+func teamNameTokens(name string) []string {
+	name = strings.Replace(strings.ToLower(name), "&", " and ", -1)
+	tokens := make([]string, 0)
+	for _, token := range teamNameSeparatorRe.Split(name, -1) {
+		switch token {
+		case "", "fc", "afc", "cf":
+			continue
+		case "utd":
+			token = "united"
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// IsSuspectedDuplicate tells whether two team names likely name the same team: word for word, each word of one
+// name starts the matching word of the other, as in "Man Utd" and "Manchester United".
+func IsSuspectedDuplicate(a, b string) bool {
+	ta, tb := teamNameTokens(a), teamNameTokens(b)
+	if len(ta) == 0 || len(ta) != len(tb) {
+		return false
+	}
+	for i, _ := range ta {
+		if !strings.HasPrefix(ta[i], tb[i]) && !strings.HasPrefix(tb[i], ta[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// SuspectedDuplicateTeams lists the pairs of teams whose names suggest they are the same team.
+func SuspectedDuplicateTeams(db *sqlx.DB) ([][2]Team, error) {
+	teams := []Team{}
+	if err := db.Select(&teams, `SELECT id, name FROM team ORDER BY name`); err != nil {
+		return nil, err
+	}
+
+	pairs := make([][2]Team, 0)
+	for i, _ := range teams {
+		for j := i + 1; j < len(teams); j++ {
+			if IsSuspectedDuplicate(teams[i].Name, teams[j].Name) {
+				pairs = append(pairs, [2]Team{teams[i], teams[j]})
+			}
+		}
+	}
+	return pairs, nil
+}
+
+// MergeTeams folds team fromId into team intoId: its aliases, matches and player stats move over to intoId,
+// under intoId's name, and fromId is deleted.
+func MergeTeams(db *sqlx.DB, fromId, intoId int64) error {
+	if fromId == intoId {
+		return fmt.Errorf("cannot merge team %d into itself", fromId)
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, id := range []int64{fromId, intoId} {
+		t := Team{}
+		if err := tx.Get(&t, `SELECT id, name FROM team WHERE id = $1`, id); err == sql.ErrNoRows {
+			return fmt.Errorf("no team with id %d", id)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	for _, q := range []string{
+		`UPDATE team_alias SET team_id = $1 WHERE team_id = $2`,
+		`UPDATE match SET home_team_id = $1, home_team_name = (SELECT name FROM team WHERE id = $1) WHERE home_team_id = $2`,
+		`UPDATE match SET away_team_id = $1, away_team_name = (SELECT name FROM team WHERE id = $1) WHERE away_team_id = $2`,
+		`UPDATE player_stats SET team_id = $1, team_name = (SELECT name FROM team WHERE id = $1) WHERE team_id = $2`,
+		`UPDATE play_direction SET team_id = $1 WHERE team_id = $2`,
+	} {
+		if _, err := tx.Exec(q, intoId, fromId); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM team WHERE id = $1`, fromId); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,193 @@
+// Package xg estimates expected goals: the probability that a shot is scored, from where it was taken.
+//
+// Shot positions are given in metres on a 105x68 pitch with the origin in the bottom left corner and the shooting
+// team attacking the goal at x = 105, the frame the crawler stores as pitch_x1 and pitch_y1.
+package xg
+
+import (
+	"errors"
+	"math"
+)
+
+// Dimensions of the pitch and the goal attacked, in metres.
+const (
+	Length    = 105.0
+	Width     = 68.0
+	GoalWidth = 7.32
+)
+
+// Distance is the distance from (x, y) to the centre of the goal, in metres.
+func Distance(x, y float64) float64 {
+	return math.Hypot(Length-x, Width/2-y)
+}
+
+// Angle is the angle between the lines from (x, y) to the two posts, in radians: how much of the goal a shot from
+// there can aim at. It is 0 on the goal line outside the posts and up to Pi between them.
+func Angle(x, y float64) float64 {
+	dx := Length - x
+	a := math.Atan2(Width/2+GoalWidth/2-y, dx) - math.Atan2(Width/2-GoalWidth/2-y, dx)
+	return math.Abs(a)
+}
+
+// Shot is a shot described by the features of the model, and whether it was scored.
+type Shot struct {
+	Distance float64
+	Angle    float64
+	Goal     bool
+}
+
+// NewShot describes a shot taken from (x, y).
+func NewShot(x, y float64, goal bool) Shot {
+	return Shot{Distance(x, y), Angle(x, y), goal}
+}
+
+// Model is a logistic regression of whether a shot is scored on its distance and angle:
+// xG = 1 / (1 + exp(-(Intercept + DistanceCoef*distance + AngleCoef*angle))).
+type Model struct {
+	Intercept    float64
+	DistanceCoef float64
+	AngleCoef    float64
+}
+
+// Predict is the probability that a shot of the given distance and angle is scored.
+func (m Model) Predict(distance, angle float64) float64 {
+	return 1 / (1 + math.Exp(-(m.Intercept + m.DistanceCoef*distance + m.AngleCoef*angle)))
+}
+
+// PredictAt is the probability that a shot from (x, y) is scored.
+func (m Model) PredictAt(x, y float64) float64 {
+	return m.Predict(Distance(x, y), Angle(x, y))
+}
+
+// ErrNotEnoughShots is returned by Fit when the shots cannot tell goals from misses: there are no goals, or no
+// misses.
+var ErrNotEnoughShots = errors.New("need at least one scored and one missed shot to fit an xG model")
+
+// ridge is a small L2 penalty on the coefficients, which keeps Fit finite on few or perfectly separated shots.
+const ridge = 1e-3
+
+// Fit estimates a model from shots by maximum likelihood, with Newton's method.
+func Fit(shots []Shot) (Model, error) {
+	var goals int
+	for _, s := range shots {
+		if s.Goal {
+			goals++
+		}
+	}
+	if goals == 0 || goals == len(shots) {
+		return Model{}, ErrNotEnoughShots
+	}
+
+	beta := [3]float64{math.Log(float64(goals) / float64(len(shots)-goals)), 0, 0}
+	likelihood := logLikelihood(shots, beta)
+	for iteration := 0; iteration < 100; iteration++ {
+		var gradient [3]float64
+		var hessian [3][3]float64
+		for i, _ := range gradient {
+			gradient[i] = -ridge * beta[i]
+			hessian[i][i] = ridge
+		}
+		for _, s := range shots {
+			x := features(s)
+			p := predict(beta, x)
+			for i, _ := range x {
+				gradient[i] += (outcome(s) - p) * x[i]
+				for j, _ := range x {
+					hessian[i][j] += p * (1 - p) * x[i] * x[j]
+				}
+			}
+		}
+
+		step, ok := solve(hessian, gradient)
+		if !ok {
+			return Model{}, errors.New("xG model does not converge: the shots' features are collinear")
+		}
+		// a full Newton step can overshoot far from the optimum, halve it until the likelihood improves; if no step
+		// does, beta is as good as it gets
+		var next [3]float64
+		improved := false
+		for scale := 1.0; scale > 1e-6 && !improved; scale /= 2 {
+			for i, _ := range beta {
+				next[i] = beta[i] + scale*step[i]
+			}
+			if l := logLikelihood(shots, next); l >= likelihood {
+				likelihood = l
+				improved = true
+			}
+		}
+		if !improved {
+			break
+		}
+		var change float64
+		for i, _ := range beta {
+			change = math.Max(change, math.Abs(next[i]-beta[i]))
+		}
+		beta = next
+		if change < 1e-9 {
+			break
+		}
+	}
+	return Model{beta[0], beta[1], beta[2]}, nil
+}
+
+func features(s Shot) [3]float64 {
+	return [3]float64{1, s.Distance, s.Angle}
+}
+
+func outcome(s Shot) float64 {
+	if s.Goal {
+		return 1
+	}
+	return 0
+}
+
+func predict(beta, x [3]float64) float64 {
+	return 1 / (1 + math.Exp(-(beta[0]*x[0] + beta[1]*x[1] + beta[2]*x[2])))
+}
+
+// logLikelihood is the penalized log likelihood of the coefficients beta given shots.
+func logLikelihood(shots []Shot, beta [3]float64) float64 {
+	l := -ridge / 2 * (beta[0]*beta[0] + beta[1]*beta[1] + beta[2]*beta[2])
+	for _, s := range shots {
+		p := predict(beta, features(s))
+		if s.Goal {
+			l += math.Log(p)
+		} else {
+			l += math.Log(1 - p)
+		}
+	}
+	return l
+}
+
+// solve solves a x = b by Gaussian elimination with partial pivoting, ok is false if a is singular.
+func solve(a [3][3]float64, b [3]float64) (x [3]float64, ok bool) {
+	n := len(b)
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return x, false
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		b[col], b[pivot] = b[pivot], b[col]
+		for row := col + 1; row < n; row++ {
+			f := a[row][col] / a[col][col]
+			for k := col; k < n; k++ {
+				a[row][k] -= f * a[col][k]
+			}
+			b[row] -= f * b[col]
+		}
+	}
+	for row := n - 1; row >= 0; row-- {
+		sum := b[row]
+		for k := row + 1; k < n; k++ {
+			sum -= a[row][k] * x[k]
+		}
+		x[row] = sum / a[row][row]
+	}
+	return x, true
+}
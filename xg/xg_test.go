@@ -0,0 +1,78 @@
+package xg
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestDistanceAndAngle(t *testing.T) {
+	for _, c := range []struct {
+		name            string
+		x, y            float64
+		distance, angle float64
+	}{
+		{"goal mouth centre", Length, Width / 2, 0, math.Pi},
+		{"goal mouth inside the post", Length, Width/2 + GoalWidth/2 - 0.5, GoalWidth/2 - 0.5, math.Pi},
+		{"goal line outside the post", Length, Width/2 + GoalWidth/2 + 5, GoalWidth/2 + 5, 0},
+		{"bottom corner", Length, 0, Width / 2, 0},
+		{"top corner", Length, Width, Width / 2, 0},
+		{"penalty spot", Length - 11, Width / 2, 11, 2 * math.Atan(GoalWidth/2/11)},
+		{"own corner", 0, 0, math.Hypot(Length, Width/2), math.Atan2(Width/2+GoalWidth/2, Length) - math.Atan2(Width/2-GoalWidth/2, Length)},
+	} {
+		if d := Distance(c.x, c.y); math.Abs(d-c.distance) > 1e-9 {
+			t.Errorf("%s: Distance(%v, %v) = %v, want %v", c.name, c.x, c.y, d, c.distance)
+		}
+		if a := Angle(c.x, c.y); math.Abs(a-c.angle) > 1e-9 {
+			t.Errorf("%s: Angle(%v, %v) = %v, want %v", c.name, c.x, c.y, a, c.angle)
+		}
+	}
+}
+
+func TestFitRecoversCoefficients(t *testing.T) {
+	want := Model{Intercept: -0.5, DistanceCoef: -0.12, AngleCoef: 1.4}
+	r := rand.New(rand.NewSource(1))
+	shots := make([]Shot, 20000)
+	for i, _ := range shots {
+		x, y := Length-35*r.Float64(), Width/2+40*(r.Float64()-0.5)
+		s := NewShot(x, y, false)
+		s.Goal = r.Float64() < want.Predict(s.Distance, s.Angle)
+		shots[i] = s
+	}
+
+	got, err := Fit(shots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(got.Intercept-want.Intercept) > 0.2 || math.Abs(got.DistanceCoef-want.DistanceCoef) > 0.02 ||
+		math.Abs(got.AngleCoef-want.AngleCoef) > 0.3 {
+		t.Errorf("Fit = %+v, want about %+v", got, want)
+	}
+}
+
+func TestFitSeparableShots(t *testing.T) {
+	shots := []Shot{}
+	for i := 0; i < 20; i++ {
+		close := float64(i) / 4
+		shots = append(shots, NewShot(Length-2-close, Width/2, true), NewShot(Length-25-close, Width/2+10, false))
+	}
+
+	m, err := Fit(shots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []float64{m.Intercept, m.DistanceCoef, m.AngleCoef} {
+		if math.IsNaN(c) || math.IsInf(c, 0) {
+			t.Fatalf("Fit on separable shots = %+v", m)
+		}
+	}
+	if near, far := m.PredictAt(Length-3, Width/2), m.PredictAt(Length-28, Width/2+10); near < 0.9 || far > 0.1 {
+		t.Errorf("separable shots fitted xG %v near goal and %v far from it", near, far)
+	}
+}
+
+func TestFitNeedsGoalsAndMisses(t *testing.T) {
+	if _, err := Fit([]Shot{NewShot(100, 34, true), NewShot(90, 30, true)}); err != ErrNotEnoughShots {
+		t.Errorf("Fit on goals only: %v, want ErrNotEnoughShots", err)
+	}
+}